@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/indeedhat/harmony/internal/config"
+)
+
+// runCommand runs one of the cli sub commands rather than starting up a peer
+func runCommand(name string, args []string) error {
+	conf := config.Load()
+	if conf == nil {
+		return fmt.Errorf("failed to load config")
+	}
+
+	switch name {
+	case "type":
+		return typeText(conf, args)
+	case "replay":
+		return replay(args)
+	case "trust":
+		return trust(conf, args)
+	case "helper":
+		return runHelper(conf)
+	default:
+		usage()
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/helper"
+)
+
+// runHelper runs the privileged input helper until it is stopped
+func runHelper(conf *config.Config) error {
+	ctx := common.NewContext(conf)
+	defer ctx.Cancel()
+
+	dev, err := device.NewDeviceManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	srv, err := helper.Listen(ctx, dev)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	return srv.Serve()
+}
@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/indeedhat/harmony/internal/app"
 	"github.com/indeedhat/harmony/internal/common"
@@ -13,8 +16,21 @@ import (
 
 func main() {
 	verbose := flag.Bool("v", false, "print logs to screen rather than log file")
-	flag.Parse()
+	record := flag.String("record", "", "record all input sent to other peers to the given file")
+	coordinator := flag.Bool(
+		"coordinator-only",
+		false,
+		"run as a dedicated server without capturing local input, no input devices or display are required",
+	)
 	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	if !*verbose {
 		logger.UseConfigFile()
@@ -26,21 +42,62 @@ func main() {
 	}
 
 	ctx := common.NewContext(conf)
+	go cancelOnSignal(ctx)
+
+	if *coordinator {
+		co, err := app.NewCoordinator(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Print(co.Run())
+		return
+	}
 
 	app, err := app.New(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *record != "" {
+		if err := app.Record(*record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	log.Print(app.Run())
 }
 
+// cancelOnSignal so that the app gets to release its devices and close the recording before exiting
+func cancelOnSignal(ctx *common.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case <-sig:
+		ctx.Cancel()
+	case <-ctx.Done():
+	}
+}
+
 func usage() {
 	fmt.Print(`Harmony HID
 Share your mouse and keyboard over the network
 
 Usage: 
-    ./harmony-hid
+    ./harmony-hid [options]
+    ./harmony-hid type [-host address] [-delay ms] [-target hostname] <text|->
+    ./harmony-hid replay [-speed n] [-target uuid] <file>
+    ./harmony-hid trust [-forget] <address[:port]>
+    ./harmony-hid helper
+
+Commands:
+    type    type the given text on the focused peer, use - to read the text from stdin
+    replay  replay a recording made with -record through a local virtual device
+    trust   pin the certificate a server currently presents, use after its certificate has changed
+    helper  run the privileged input helper, this owns the input devices so that the main process
+            does not need access to them, see [helper] in the config
 
 Options:
 `)
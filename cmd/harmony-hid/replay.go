@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/recording"
+)
+
+// replay a recording through a local virtual device
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := flags.Float64("speed", 1, "playback speed multiplier, 0 replays with no delay between events")
+	target := flags.String("target", "", "only replay input that was sent to the peer with this uuid")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("no recording given")
+	}
+
+	opts := recording.ReplayOptions{Speed: *speed}
+	if *target != "" {
+		id, err := uuid.Parse(*target)
+		if err != nil {
+			return fmt.Errorf("invalid target: %w", err)
+		}
+
+		opts.Target = id
+	}
+
+	reader, err := recording.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	vdev, err := device.CreateVirtualDevice()
+	if err != nil {
+		return fmt.Errorf("failed to create virtual device: %w", err)
+	}
+	defer vdev.Close()
+
+	// give the window server a chance to pick up the new device
+	time.Sleep(time.Second)
+
+	return recording.Replay(context.Background(), reader, vdev, opts)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/net/certs"
+)
+
+// trust pins the certificate a server currently presents, replacing any existing pin
+func trust(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("trust", flag.ExitOnError)
+	forget := flags.Bool("forget", false, "remove the pin so the certificate is trusted again on next connect")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("no server address given")
+	}
+
+	address := flags.Arg(0)
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(conf.Server.Port))
+	}
+
+	pins, err := certs.LoadPins(conf.Security.KnownServers)
+	if err != nil {
+		return err
+	}
+
+	if *forget {
+		return pins.Forget(address)
+	}
+
+	con, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer con.Close()
+
+	peerCerts := con.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+
+	sum := sha256.Sum256(peerCerts[0].Raw)
+	fingerprint := sum[:]
+
+	if pinned, ok := pins.Get(address); ok {
+		fmt.Printf("previous fingerprint: %s\n", certs.FormatFingerprint(pinned))
+	}
+	fmt.Printf("trusting %s\nfingerprint: %s\n", address, certs.FormatFingerprint(fingerprint))
+
+	return pins.Pin(address, fingerprint)
+}
+
+// pinnedClient creates a http client for talking to the server at address that only accepts its pinned
+// certificate, a server that has not been pinned with the trust command is refused
+func pinnedClient(conf *config.Config, address string) (*http.Client, error) {
+	pins, err := certs.LoadPins(conf.Security.KnownServers)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, _ := pins.TLSConfig(address, nil)
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
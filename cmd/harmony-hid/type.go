@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/indeedhat/harmony/internal/config"
+)
+
+// typeText sends text to the cluster server to be typed out on the focused peer
+func typeText(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("type", flag.ExitOnError)
+	host := flags.String("host", "127.0.0.1", "address of the cluster server")
+	delay := flags.Uint("delay", 0, "delay between key strokes in milliseconds (defaults to the peers config)")
+	target := flags.String("target", "", "hostname of the peer to type on (defaults to the focused peer)")
+	flags.Parse(args)
+
+	text := strings.Join(flags.Args(), " ")
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+
+		text = strings.TrimSuffix(string(data), "\n")
+	}
+
+	if text == "" {
+		return fmt.Errorf("no text given")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"text":     text,
+		"delay_ms": *delay,
+		"target":   *target,
+	})
+	if err != nil {
+		return err
+	}
+
+	address := fmt.Sprintf("%s:%d", *host, conf.Server.Port)
+	client, err := pinnedClient(conf, address)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://%s/api/type", address)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+conf.Security.ClusterSecret)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server rejected text: %s", msg)
+	}
+
+	return nil
+}
@@ -1,18 +1,30 @@
 package app
 
 import (
+	"crypto/tls"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/config"
 	"github.com/indeedhat/harmony/internal/device"
 	"github.com/indeedhat/harmony/internal/events"
+	"github.com/indeedhat/harmony/internal/helper"
 	. "github.com/indeedhat/harmony/internal/logger"
 	"github.com/indeedhat/harmony/internal/net"
+	"github.com/indeedhat/harmony/internal/net/certs"
 	"github.com/indeedhat/harmony/internal/net/discovery"
 	"github.com/indeedhat/harmony/internal/net/server/router"
+	"github.com/indeedhat/harmony/internal/recording"
 	"github.com/indeedhat/harmony/internal/screens"
+	"github.com/indeedhat/harmony/internal/trust"
+)
+
+// backoff between attempts to reconnect to the server
+const (
+	reconnectDelay    = 500 * time.Millisecond
+	reconnectMaxDelay = 8 * time.Second
 )
 
 type Harmony struct {
@@ -20,35 +32,109 @@ type Harmony struct {
 	// discovery service used to locate existing servers on startup
 	discover *discovery.Service
 	// os independent device manager
-	dev *device.DeviceManager
+	dev device.Manager
 	// local window server manager
 	vdu device.Vdu
 	// if this peer is in server mode or not
 	serverMode bool
 	// if this peer has active control of another peer or not
 	active bool
+	// if this peers keyboards have been sent to another peer while the pointer stays local
+	keyboardRemote bool
+	// hotkeys for moving keyboard focus on its own
+	keyboardNext  []uint16
+	keyboardReset []uint16
+	// hotkey that brings focus back to this peer
+	focusHome []uint16
+	// if this peers keyboard is being broadcast to several peers
+	broadcasting    bool
+	broadcastHotkey []uint16
+	// peer that was last given focus by this peer
+	target uuid.UUID
+	// optional recording of all the input sent to other peers
+	recorder *recording.Writer
 	// client connected to the socket server
 	client *net.Client
+	// server the client last connected to, it is tried first when the connection drops
+	server discovery.Server
 	// uuid to identify this peer over the network
 	uuid uuid.UUID
+	// identity proves the uuid belongs to this peer
+	identity *trust.Identity
+	// certificate used if this peer ends up running the server
+	cert tls.Certificate
 	// transition zones are used to define screen edges that 'transition' to other peers
 	tZones []screens.TransitionZone
 	// cache the times of the last n alt key up events
 	// if enough events happen in a specified time frame then all clients peers
 	// will be told to release focus and exclusive access locks on all devices
 	altCache []time.Time
+	// keys currently held on this peers devices
+	chords *device.ChordTracker
+	// macro bindings synced from the server
+	macros events.MacrosUpdated
+	// macro recording state
+	macroRec *macroRecorder
+	// keys that stay on this peer while it controls another
+	localKeys device.KeySet
+	// keys that are routed to the media host while this peer controls another
+	mediaKeys device.KeySet
 }
 
 // New sets up a new Harmony instance
 func New(ctx *common.Context) (*Harmony, error) {
-	Log("app", "hid discovery")
-	dev, err := device.NewDeviceManager(ctx)
+	dev, err := newDeviceManager(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	Log("app", "vdu discovery")
-	vdu, err := device.NewVdu()
+	vdu, err := newVdu(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	macroRec, err := newMacroRecorder(ctx.Config.Macros.RecordChord)
+	if err != nil {
+		return nil, fmt.Errorf("bad macro record chord: %w", err)
+	}
+
+	keyboardNext, err := device.ParseChord(ctx.Config.Focus.KeyboardNext)
+	if err != nil {
+		return nil, fmt.Errorf("bad keyboard focus hotkey: %w", err)
+	}
+
+	keyboardReset, err := device.ParseChord(ctx.Config.Focus.KeyboardReset)
+	if err != nil {
+		return nil, fmt.Errorf("bad keyboard focus hotkey: %w", err)
+	}
+
+	focusHome, err := device.ParseChord(ctx.Config.Focus.Home)
+	if err != nil {
+		return nil, fmt.Errorf("bad focus home hotkey: %w", err)
+	}
+
+	broadcastHotkey, err := device.ParseChord(ctx.Config.Broadcast.Hotkey)
+	if err != nil {
+		return nil, fmt.Errorf("bad broadcast hotkey: %w", err)
+	}
+
+	localKeys, err := device.ParseKeySet(ctx.Config.LocalKeys.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("bad local keys: %w", err)
+	}
+
+	mediaKeys, err := device.ParseKeySet(ctx.Config.LocalKeys.MediaKeys)
+	if err != nil {
+		return nil, fmt.Errorf("bad media keys: %w", err)
+	}
+
+	cert, err := certs.LoadOrCreate(ctx.Config.Security.CertFile, ctx.Config.Security.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	identity, err := trust.LoadIdentity(ctx.Config.Peer.IdentityFile)
 	if err != nil {
 		return nil, err
 	}
@@ -59,31 +145,72 @@ func New(ctx *common.Context) (*Harmony, error) {
 		return nil, err
 	}
 
+	discover.SetFingerprint(certs.Fingerprint(cert))
+
 	return &Harmony{
-		ctx:      ctx,
-		discover: discover,
-		dev:      dev,
-		uuid:     uuid.New(),
-		vdu:      vdu,
+		ctx:           ctx,
+		discover:      discover,
+		dev:           dev,
+		uuid:          identity.UUID,
+		identity:      identity,
+		cert:          cert,
+		vdu:           vdu,
+		chords:        device.NewChordTracker(),
+		macroRec:      macroRec,
+		localKeys:     localKeys,
+		mediaKeys:     mediaKeys,
+		keyboardNext:  keyboardNext,
+		keyboardReset: keyboardReset,
+		focusHome:     focusHome,
+
+		broadcastHotkey: broadcastHotkey,
 	}, nil
 }
 
+// newDeviceManager gives access to the local devices
+// if a privileged helper is configured it owns the devices and this process talks to it instead
+func newDeviceManager(ctx *common.Context) (device.Manager, error) {
+	if ctx.Config.Helper.Socket != "" {
+		Log("app", "connecting to input helper")
+		return helper.Dial(ctx)
+	}
+
+	Log("app", "hid discovery")
+	return device.NewDeviceManager(ctx)
+}
+
 // Run the application
 func (app *Harmony) Run() error {
 	Logf("app", "uuid: %s", app.uuid)
 	defer app.ctx.Cancel()
 	defer app.discover.Close()
 
+	if app.recorder != nil {
+		defer app.recorder.Close()
+	}
+
 	if err := app.runDiscovery(); err != nil {
 		return err
 	}
 
-	go app.watchTransitionZones()
+	// shut down before a server was found
+	if app.client == nil {
+		return nil
+	}
+
+	// receive only peers never take control of others so there is no need to watch the cursor
+	if app.ctx.Config.Peer.Role != config.PeerRoleReceive {
+		go app.watchTransitionZones()
+	}
 
 	for {
 		select {
-		case ev := <-app.dev.Events:
-			app.handleInputEvent(ev)
+		case frame := <-app.dev.IO().Events:
+			app.handleInputFrame(frame)
+
+		case msg := <-app.dev.IO().Mirrored:
+			// mirrored devices are routed by the server regardless of focus
+			app.client.Input <- msg
 
 		case ev := <-app.client.Events:
 			app.handleServerEvent(ev)
@@ -92,27 +219,67 @@ func (app *Harmony) Run() error {
 			return nil
 
 		case <-app.client.Done():
-			Log("app", "restarting discovery process")
-
-			// grace period to ensure that the disconnected server has fully shut down
-			<-time.After(2 * time.Second)
-
-			if err := app.runDiscovery(); err != nil {
+			if err := app.reconnect(); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func (app *Harmony) runDiscovery() error {
-	// reset app state
+// reconnect to the last server, backing off between attempts
+// discovery is only run again once the server has failed to answer the configured number of times
+func (app *Harmony) reconnect() error {
+	// the devices are handed back while disconnected, if the server resumes the session it says
+	// where focus was so they can be grabbed again
+	app.resetFocus()
+
+	delay := reconnectDelay
+	for attempt := 1; attempt <= app.ctx.Config.Peer.ReconnectAttempts; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-app.ctx.Done():
+			return nil
+		}
+
+		Logf("app", "reconnecting to server (attempt %d)", attempt)
+		err := app.startClient(app.server)
+		if err == nil {
+			return nil
+		}
+
+		Logf("app", "reconnect failed: %s", err)
+		if delay *= 2; delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+
+	Log("app", "restarting discovery process")
+
+	// grace period to ensure that the disconnected server has fully shut down
+	<-time.After(2 * time.Second)
+
+	return app.runDiscovery()
+}
+
+// resetFocus hands the devices back to this peer
+func (app *Harmony) resetFocus() {
 	app.active = false
+	app.keyboardRemote = false
+	app.broadcasting = false
 	app.dev.ReleaseAccess()
+}
 
+func (app *Harmony) runDiscovery() error {
+	app.resetFocus()
 	app.discover.Run()
 
 	// need to block until we have a client connected
-	server := <-app.discover.Server
+	var server discovery.Server
+	select {
+	case server = <-app.discover.Server:
+	case <-app.ctx.Done():
+		return nil
+	}
 
 	Log("app", "handling discovery event")
 	if err := app.handleDiscoveryMessage(server); err != nil {
@@ -126,7 +293,12 @@ func (app *Harmony) handleServerEvent(data []byte) {
 	switch events.MsgType(data[0]) {
 	case events.MsgTypeInputEvent:
 		if event := events.Unmarshal[events.InputEvent](data[2:]); event != nil {
-			app.dev.Input <- event
+			app.dev.IO().Input <- &events.InputFrame{Events: []events.InputEvent{*event}}
+		}
+
+	case events.MsgTypeInputFrame:
+		if frame := events.Unmarshal[events.InputFrame](data[2:]); frame != nil {
+			app.dev.IO().Input <- frame
 		}
 
 	case events.MsgTypeReleaseFouces:
@@ -134,8 +306,14 @@ func (app *Harmony) handleServerEvent(data []byte) {
 
 		if event := events.Unmarshal[events.ReleaseFocus](data[2:]); event != nil {
 			Log("app", "release focus")
+			if app.active {
+				app.record(recording.RecordRelease, nil)
+			}
+
 			app.dev.ReleaseAccess()
 			app.active = false
+			app.keyboardRemote = false
+			app.broadcasting = false
 
 			cursorPos, err := app.vdu.CursorPos()
 			if err != nil {
@@ -158,16 +336,40 @@ func (app *Harmony) handleServerEvent(data []byte) {
 
 	case events.MsgTypeFocusRecieved:
 		Log("app", "handling focus recieved")
-		if event := events.Unmarshal[events.FocusRecieved](data[2:]); event == nil {
+		event := events.Unmarshal[events.FocusRecieved](data[2:])
+		if event == nil {
 			return
 		}
 
 		Log("app", "focus recieved")
+		if app.active {
+			app.record(recording.RecordRelease, nil)
+		}
+
 		app.active = false
+		app.keyboardRemote = false
 		app.dev.ReleaseAccess()
+		app.dev.SetKeyRepeat(event.Repeat)
+		// a running broadcast still needs the keyboards
+		app.syncKeyboardGrab()
 
 		// TODO: move mouse to proper place in transition zone
 
+	case events.MsgTypeKeyboardFocusChanged:
+		if event := events.Unmarshal[events.KeyboardFocusChanged](data[2:]); event != nil {
+			app.handleKeyboardFocusChanged(event)
+		}
+
+	case events.MsgTypeSessionResumed:
+		if event := events.Unmarshal[events.SessionResumed](data[2:]); event != nil {
+			app.handleSessionResumed(event)
+		}
+
+	case events.MsgTypeBroadcastState:
+		if event := events.Unmarshal[events.BroadcastState](data[2:]); event != nil {
+			app.handleBroadcastState(event)
+		}
+
 	case events.MsgTypeTrasitionAssigned:
 		Log("app", "handling new transition zones")
 		if event := events.Unmarshal[events.TransitionZoneAssigned](data[2:]); event != nil {
@@ -176,28 +378,268 @@ func (app *Harmony) handleServerEvent(data []byte) {
 			app.tZones = *event
 		}
 
+	case events.MsgTypeDeviceAttached:
+		if event := events.Unmarshal[events.DeviceAttached](data[2:]); event != nil {
+			Logf("app", "attaching mirror device: %s", event.Name)
+			if err := app.dev.AttachMirror(event); err != nil {
+				Logf("app", "%s", err)
+			}
+		}
+
+	case events.MsgTypeDeviceDetached:
+		if event := events.Unmarshal[events.DeviceDetached](data[2:]); event != nil {
+			Logf("app", "detaching mirror device: %s", event.ID)
+			app.dev.DetachMirror(event.Source, event.ID)
+		}
+
+	case events.MsgTypeDeviceInput:
+		if event := events.Unmarshal[events.DeviceInput](data[2:]); event != nil {
+			app.dev.IO().MirrorInput <- event
+		}
+
+	case events.MsgTypeMacrosUpdated:
+		if event := events.Unmarshal[events.MacrosUpdated](data[2:]); event != nil {
+			Logf("app", "recieved %d macro bindings", len(*event))
+			app.macros = *event
+		}
+
+	case events.MsgTypeMacroPlayback:
+		if event := events.Unmarshal[events.MacroPlayback](data[2:]); event != nil {
+			go app.playMacro(event)
+		}
+
+	case events.MsgTypeTypeText:
+		Log("app", "handling type text")
+		if event := events.Unmarshal[events.TypeText](data[2:]); event != nil {
+			go app.typeText(event)
+		}
+
 	default:
 		Logf("app", "unknown message type: %d", data[0])
 	}
 }
 
+// handleKeyboardFocusChanged grabs or releases the local keyboards depending on where keyboard focus went
+func (app *Harmony) handleKeyboardFocusChanged(event *events.KeyboardFocusChanged) {
+	app.keyboardRemote = event.UUID != app.uuid
+	Logf("app", "keyboard focus: %s", event.UUID)
+
+	if err := app.syncKeyboardGrab(); err != nil {
+		Logf("app", "failed to grab keyboards: %s", err)
+		app.keyboardRemote = false
+		app.client.Input <- &events.MoveKeyboardFocus{Reset: true}
+	}
+}
+
+// handleSessionResumed takes back the focus this peer had before its connection dropped
+func (app *Harmony) handleSessionResumed(event *events.SessionResumed) {
+	Log("app", "session resumed")
+
+	if event.Pointer != uuid.Nil {
+		if err := app.dev.GrabAccess(); err != nil {
+			Logf("app", "failed to grab devices: %s", err)
+			app.client.Input <- &events.ChangeFocus{
+				UUID:   app.uuid,
+				Repeat: app.dev.KeyRepeat(),
+			}
+			return
+		}
+
+		app.active = true
+		app.target = event.Pointer
+		return
+	}
+
+	if event.Keyboard != uuid.Nil {
+		app.handleKeyboardFocusChanged(&events.KeyboardFocusChanged{UUID: event.Keyboard})
+	}
+}
+
+// handleBroadcastState keeps the keyboards grabbed while this peer is the source of a broadcast
+func (app *Harmony) handleBroadcastState(event *events.BroadcastState) {
+	app.broadcasting = event.Active && event.Source == app.uuid
+
+	if event.Active {
+		Logf("app", "BROADCAST INPUT ACTIVE: %s -> %v until %s",
+			event.Source, event.Peers, time.Unix(event.Until, 0).Format(time.Kitchen))
+	} else {
+		Log("app", "broadcast input stopped")
+	}
+
+	if err := app.syncKeyboardGrab(); err != nil {
+		Logf("app", "failed to grab keyboards: %s", err)
+		app.broadcasting = false
+		app.client.Input <- &events.ToggleBroadcast{}
+	}
+}
+
+// syncKeyboardGrab grabs the local keyboards while they are being sent elsewhere without the pointer
+// while this peer is active all its devices are already grabbed and the server routes the keyboard events
+func (app *Harmony) syncKeyboardGrab() error {
+	if app.active {
+		return nil
+	}
+
+	if app.keyboardRemote || app.broadcasting {
+		return app.dev.GrabKeyboards()
+	}
+
+	return app.dev.ReleaseAccess()
+}
+
+// typeText on the local keyboard layout via the virtual device
+func (app *Harmony) typeText(event *events.TypeText) {
+	keymap, err := app.vdu.KeyMap()
+	if err != nil {
+		Logf("app", "failed to load keymap: %s", err)
+		return
+	}
+
+	delay := time.Duration(app.ctx.Config.TextInput.KeyDelayMs) * time.Millisecond
+	if event.DelayMs != 0 {
+		delay = time.Duration(event.DelayMs) * time.Millisecond
+	}
+
+	app.dev.TypeText(event.Text, keymap, delay, app.ctx.Config.TextInput.UnicodeFallback)
+}
+
 func (app *Harmony) handleDiscoveryMessage(server discovery.Server) error {
 	if server.IpAddress == "" {
 		Log("app", "starting server")
 		app.runServer()
+
+		server.Fingerprint = certs.Fingerprint(app.cert)
 	}
 
 	Log("app", "connecting as peer")
-	return app.startClient(server.IpAddress)
+	return app.startClient(server)
 }
 
-func (app *Harmony) handleInputEvent(event *events.InputEvent) {
-	app.handleEmergancyRelease(event)
+func (app *Harmony) handleInputFrame(frame *events.InputFrame) {
+	for i := range frame.Events {
+		app.handleEmergancyRelease(&frame.Events[i])
+
+		if app.chords.Update(&frame.Events[i]) {
+			app.handleFocusHotkeys()
+			app.handleMacroChords()
+		}
+	}
+
+	// pinned devices are forwarded regardless of focus
+	if frame.Target != "" {
+		app.client.Input <- frame
+		return
+	}
+
+	app.recordMacroStep(frame)
+
 	if !app.active {
+		if !app.keyboardRemote && !app.broadcasting {
+			return
+		}
+
+		// only the keyboard is being controlled remotely, the pointer stays local
+		if frame, _ = device.SplitPointer(frame); frame == nil {
+			return
+		}
+	}
+
+	// the peer with focus will generate its own repeats
+	if app.ctx.Config.Keyboard.RepeatMode == config.RepeatModeTarget {
+		if frame = device.DropKeyRepeats(frame); frame == nil {
+			return
+		}
+	}
+
+	if frame = app.routeKeys(frame); frame == nil {
 		return
 	}
 
-	app.client.Input <- event
+	app.record(recording.RecordInput, frame)
+	app.client.Input <- frame
+}
+
+// handleFocusHotkeys checks the held keys against the keyboard focus hotkeys
+func (app *Harmony) handleFocusHotkeys() {
+	switch {
+	case app.chords.Held(app.keyboardNext):
+		Log("app", "move keyboard focus")
+		app.client.Input <- &events.MoveKeyboardFocus{}
+
+	case app.chords.Held(app.keyboardReset):
+		Log("app", "reset keyboard focus")
+		app.client.Input <- &events.MoveKeyboardFocus{Reset: true}
+
+	case app.chords.Held(app.focusHome) && app.active:
+		Log("app", "bring focus home")
+		app.client.Input <- &events.ChangeFocus{
+			UUID:   app.uuid,
+			Repeat: app.dev.KeyRepeat(),
+		}
+
+	case app.chords.Held(app.broadcastHotkey):
+		Log("app", "toggle broadcast")
+		app.client.Input <- &events.ToggleBroadcast{}
+	}
+}
+
+// routeKeys splits local and media keys out of a frame that is being sent to the focused peer
+// local keys are written to this peers virtual device and media keys are pinned to the media host
+// the remaining frame is returned, or nil if there is nothing left to forward
+func (app *Harmony) routeKeys(frame *events.InputFrame) *events.InputFrame {
+	local, frame := app.localKeys.Split(frame)
+	if local != nil {
+		app.dev.IO().Input <- local
+	}
+
+	if frame == nil {
+		return nil
+	}
+
+	media, frame := app.mediaKeys.Split(frame)
+	if media != nil {
+		media.Target = app.ctx.Config.LocalKeys.MediaHost
+		app.client.Input <- media
+	}
+
+	return frame
+}
+
+// newVdu for the peer, static displays from the config take priority over the window server
+func newVdu(ctx *common.Context) (device.Vdu, error) {
+	if len(ctx.Config.Peer.Displays) != 0 {
+		return device.NewStaticVdu(ctx.Config.Peer.Displays)
+	}
+
+	return device.NewVdu()
+}
+
+// Record all of the input sent to other peers to a file
+func (app *Harmony) Record(path string) error {
+	recorder, err := recording.Create(path)
+	if err != nil {
+		return err
+	}
+
+	app.recorder = recorder
+	return nil
+}
+
+// record an entry in the input recording if one is running
+func (app *Harmony) record(typ recording.RecordType, frame *events.InputFrame) {
+	if app.recorder == nil {
+		return
+	}
+
+	err := app.recorder.Write(&recording.Record{
+		Time:   time.Now().UnixNano(),
+		Type:   typ,
+		Target: app.target,
+		Frame:  frame,
+	})
+	if err != nil {
+		Logf("app", "failed to write recording: %s", err)
+	}
 }
 
 func (app *Harmony) handleEmergancyRelease(event *events.InputEvent) {
@@ -230,9 +672,13 @@ func (app *Harmony) runServer() {
 	}
 
 	app.serverMode = true
+	Logf("app", "certificate fingerprint: %s", certs.FormatFingerprint(certs.Fingerprint(app.cert)))
+
 	go func() {
-		r := router.New(app.ctx, app.uuid, nil)
-		r.Run(fmt.Sprint(":", app.ctx.Config.Server.Port))
+		r := router.New(app.ctx, app.uuid, app.identity.PublicKey(), nil)
+		if err := router.RunTLS(app.ctx, r, app.cert); err != nil {
+			Logf("app", "server stopped: %s", err)
+		}
 	}()
 
 	// bit dirty but need to make sure the server satrts before connecting as a peer
@@ -240,7 +686,8 @@ func (app *Harmony) runServer() {
 	time.Sleep(time.Second * 2)
 }
 
-func (app *Harmony) startClient(ip string) error {
+func (app *Harmony) startClient(server discovery.Server) error {
+	ip := server.IpAddress
 	if ip == "" {
 		ip = "127.0.0.1"
 	}
@@ -250,12 +697,19 @@ func (app *Harmony) startClient(ip string) error {
 		return err
 	}
 
-	client, err := net.NewClient(app.ctx, app.uuid, ip, screens)
+	client, err := net.NewClient(app.ctx, app.identity, ip, server.Fingerprint, screens)
 	if err != nil {
 		return err
 	}
 
 	app.client = client
+	app.server = server
+
+	for _, info := range app.dev.MirroredDevices() {
+		Logf("app", "announcing mirrored device: %s", info.Name)
+		client.Input <- info
+	}
+
 	return nil
 }
 
@@ -297,9 +751,12 @@ func (app *Harmony) watchTransitionZones() {
 
 				Log("app", "giving up focus")
 				app.active = true
+				app.target = zone.Target.UUID
+				app.record(recording.RecordFocus, nil)
 				app.client.Input <- &events.ChangeFocus{
-					UUID: zone.Target.UUID,
-					Pos:  *pos,
+					UUID:   zone.Target.UUID,
+					Pos:    *pos,
+					Repeat: app.dev.KeyRepeat(),
 				}
 			}
 
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/common"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/certs"
+	"github.com/indeedhat/harmony/internal/net/discovery"
+	"github.com/indeedhat/harmony/internal/net/server/router"
+)
+
+// Coordinator runs the server side of a cluster without capturing any local input
+// it answers discovery requests and hosts the websocket hub and ui but never connects as a peer, so
+// it has no need for input devices or a display
+type Coordinator struct {
+	ctx *common.Context
+	// discovery service used to answer peers looking for a server
+	discover *discovery.Service
+	// uuid to identify the server, no peer will ever connect with it
+	uuid uuid.UUID
+	// certificate the server is served with
+	cert tls.Certificate
+}
+
+// NewCoordinator sets up a new coordinator instance
+func NewCoordinator(ctx *common.Context) (*Coordinator, error) {
+	cert, err := certs.LoadOrCreate(ctx.Config.Security.CertFile, ctx.Config.Security.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	Log("app", "starting coordinator discovery")
+	discover, err := discovery.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	discover.SetFingerprint(certs.Fingerprint(cert))
+
+	return &Coordinator{
+		ctx:      ctx,
+		discover: discover,
+		uuid:     uuid.New(),
+		cert:     cert,
+	}, nil
+}
+
+// Run the coordinator
+// this will block until the server stops
+func (co *Coordinator) Run() error {
+	Logf("app", "coordinator uuid: %s", co.uuid)
+	Logf("app", "certificate fingerprint: %s", certs.FormatFingerprint(certs.Fingerprint(co.cert)))
+	defer co.ctx.Cancel()
+	defer co.discover.Close()
+
+	co.discover.Serve()
+
+	r := router.New(co.ctx, co.uuid, nil, nil)
+	return router.RunTLS(co.ctx, r, co.cert)
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"time"
+
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// recordings are stopped once they reach this many steps to keep them within the message size limit
+const maxMacroSteps = 500
+
+// macroRecorder holds the chords that control macro recording and the recording in progress
+type macroRecorder struct {
+	// chords that toggle, start and stop recording
+	toggle []uint16
+	start  []uint16
+	stop   []uint16
+
+	recording bool
+	last      time.Time
+	steps     []events.MacroStep
+	// keys of the chord that started recording that are still held, they are left out of the recording
+	chordHeld map[uint16]bool
+}
+
+// newMacroRecorder parses the configured record chord along with the dedicated record keys
+func newMacroRecorder(recordChord string) (*macroRecorder, error) {
+	toggle, err := device.ParseChord(recordChord)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := device.ParseChord("KEY_MACRO_RECORD_START")
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := device.ParseChord("KEY_MACRO_RECORD_STOP")
+	if err != nil {
+		return nil, err
+	}
+
+	return &macroRecorder{
+		toggle: toggle,
+		start:  start,
+		stop:   stop,
+	}, nil
+}
+
+// dropChordPresses removes the presses of the chord that stopped recording
+// its keys are still held so the last press of each in the recording is the one that made up the chord
+func (rec *macroRecorder) dropChordPresses(chord []uint16) {
+	for _, code := range chord {
+		if rec.chordHeld[code] {
+			continue
+		}
+
+	search:
+		for i := len(rec.steps) - 1; i >= 0; i-- {
+			evs := rec.steps[i].Frame.Events
+			for j := len(evs) - 1; j >= 0; j-- {
+				if !device.IsKeyEvent(&evs[j]) || evs[j].Code != code {
+					continue
+				}
+
+				pressed := evs[j].Value == 1
+				evs = append(evs[:j:j], evs[j+1:]...)
+				rec.steps[i].Frame.Events = evs
+
+				if pressed {
+					break search
+				}
+			}
+		}
+	}
+
+	// steps left with nothing but the sync report are dropped, their delay moves on to the next step
+	var (
+		steps []events.MacroStep
+		delay int64
+	)
+	for _, step := range rec.steps {
+		delay += step.DelayMs
+		if len(step.Frame.Events) < 2 {
+			continue
+		}
+
+		step.DelayMs = delay
+		delay = 0
+		steps = append(steps, step)
+	}
+
+	rec.steps = steps
+}
+
+// handleMacroChords checks the held keys against the recording chords and bound macros
+func (app *Harmony) handleMacroChords() {
+	rec := app.macroRec
+
+	switch {
+	case app.chords.Held(rec.start) && !rec.recording:
+		app.startMacro(rec.start)
+		return
+
+	case app.chords.Held(rec.toggle) && !rec.recording:
+		app.startMacro(rec.toggle)
+		return
+
+	case app.chords.Held(rec.stop) && rec.recording:
+		app.finishMacro(rec.stop)
+		return
+
+	case app.chords.Held(rec.toggle) && rec.recording:
+		app.finishMacro(rec.toggle)
+		return
+	}
+
+	for _, macro := range app.macros {
+		if app.chords.Held(macro.Chord) {
+			Logf("app", "play macro: %s", macro.Name)
+			app.client.Input <- &events.PlayMacro{Name: macro.Name}
+			return
+		}
+	}
+}
+
+// recordMacroStep adds the frame to the macro being recorded
+func (app *Harmony) recordMacroStep(frame *events.InputFrame) {
+	rec := app.macroRec
+	if !rec.recording {
+		return
+	}
+
+	step := events.MacroStep{}
+	for _, event := range frame.Events {
+		if device.IsKeyEvent(&event) && rec.chordHeld[event.Code] {
+			if event.Value == 0 {
+				delete(rec.chordHeld, event.Code)
+			}
+			continue
+		}
+
+		step.Frame.Events = append(step.Frame.Events, event)
+	}
+
+	// nothing left but the sync report
+	if len(step.Frame.Events) < 2 {
+		return
+	}
+
+	now := time.Now()
+	step.DelayMs = now.Sub(rec.last).Milliseconds()
+	rec.last = now
+	rec.steps = append(rec.steps, step)
+
+	if len(rec.steps) >= maxMacroSteps {
+		Log("app", "macro step limit reached")
+		app.finishMacro(nil)
+	}
+}
+
+// startMacro recording, the chord that started it is left out of the recording
+func (app *Harmony) startMacro(chord []uint16) {
+	rec := app.macroRec
+
+	Log("app", "macro recording started")
+	rec.recording = true
+	rec.last = time.Now()
+	rec.steps = nil
+	rec.chordHeld = make(map[uint16]bool, len(chord))
+
+	for _, code := range chord {
+		rec.chordHeld[code] = true
+	}
+}
+
+// finishMacro stops recording and sends the macro to the server to be stored
+// the chord that stopped recording, if any, is left out of the recording
+func (app *Harmony) finishMacro(chord []uint16) {
+	rec := app.macroRec
+	rec.recording = false
+	rec.dropChordPresses(chord)
+	rec.chordHeld = nil
+
+	if len(rec.steps) == 0 {
+		Log("app", "macro recording empty")
+		return
+	}
+
+	Logf("app", "macro recorded: %d steps", len(rec.steps))
+	app.client.Input <- &events.MacroRecorded{Steps: rec.steps}
+	rec.steps = nil
+}
+
+// playMacro on the local virtual device keeping the delays between each step
+func (app *Harmony) playMacro(event *events.MacroPlayback) {
+	Logf("app", "playing macro: %s", event.Name)
+
+	for i := range event.Steps {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-time.After(time.Duration(event.Steps[i].DelayMs) * time.Millisecond):
+		}
+
+		app.dev.IO().Input <- &event.Steps[i].Frame
+	}
+}
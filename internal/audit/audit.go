@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/indeedhat/harmony/internal/logger"
+)
+
+// default file the audit log is written to if none is configured
+const DefaultFile = "audit.log"
+
+// Audited events
+const (
+	EventConnect           = "connect"
+	EventDisconnect        = "disconnect"
+	EventResume            = "resume"
+	EventExpire            = "expire"
+	EventPending           = "pending"
+	EventApprove           = "approve"
+	EventReject            = "reject"
+	EventRevoke            = "revoke"
+	EventHandshakeRejected = "handshake_rejected"
+	EventFocus             = "focus"
+	EventFocusDenied       = "focus_denied"
+	EventKeyboardFocus     = "keyboard_focus"
+	EventEmergencyRelease  = "emergency_release"
+	EventBroadcastStart    = "broadcast_start"
+	EventBroadcastStop     = "broadcast_stop"
+	EventChordBlocked      = "chord_blocked"
+)
+
+// Entry in the audit log, each entry is written as a single line of json
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Peer that caused the event
+	Peer     string `json:"peer,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Address  string `json:"address,omitempty"`
+	// Target peer of the event, eg. the peer that focus moved to
+	Target         string `json:"target,omitempty"`
+	TargetHostname string `json:"target_hostname,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+}
+
+// Query filters entries read back from the log
+type Query struct {
+	Since time.Time
+	Event string
+	// Peer matches entries where the peer is either the cause or the target
+	Peer string
+	// Limit to the most recent n entries
+	Limit int
+}
+
+// match reports if the entry passes the query filters
+func (q Query) match(entry *Entry) bool {
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+
+	if q.Event != "" && entry.Event != q.Event {
+		return false
+	}
+
+	if q.Peer != "" && entry.Peer != q.Peer && entry.Target != q.Peer {
+		return false
+	}
+
+	return true
+}
+
+// Log is an append only record of security relevant events on the server
+// it is kept separate from the debug log so that it can be retained and reviewed on its own
+type Log struct {
+	path string
+	fh   *os.File
+	mux  sync.Mutex
+}
+
+// Open the audit log for appending, creating it if it does not exist
+func Open(path string) (*Log, error) {
+	if path == "" {
+		path = DefaultFile
+	}
+
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &Log{path: path, fh: fh}, nil
+}
+
+// Record an entry in the log
+// failing to write is reported on the debug log rather than stopping the server
+func (l *Log) Record(entry Entry) {
+	entry.Time = time.Now().UTC()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Logf("audit", "failed to marshal entry: %s", err)
+		return
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, err := l.fh.Write(append(data, '\n')); err != nil {
+		logger.Logf("audit", "failed to write entry: %s", err)
+	}
+}
+
+// Query reads back the entries matching the query, oldest first
+// the file is read through its own handle so recording is never held up by a query, an entry that is
+// only partly written when it is reached fails to parse and is skipped
+func (l *Log) Query(q Query) ([]Entry, error) {
+	fh, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer fh.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if !q.match(&entry) {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if q.Limit > 0 && len(entries) > q.Limit {
+			entries = entries[1:]
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// Close the log
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.fh.Close()
+}
@@ -25,11 +25,184 @@ type Config struct {
 		ClusterId           string `toml:"cluster_id" validate:"required,max=16"`
 	} `toml:"discovery"`
 
+	Security struct {
+		// ClusterSecret is shared by every peer in the cluster, peers that cannot prove they know it
+		// are rejected
+		ClusterSecret string `toml:"cluster_secret" validate:"required,min=16"`
+		// CertFile and KeyFile for the servers tls certificate, a self signed pair is generated if
+		// they dont exist
+		CertFile string `toml:"cert_file"`
+		KeyFile  string `toml:"key_file"`
+		// KnownServers file that the fingerprints of trusted servers are pinned in
+		KnownServers string `toml:"known_servers"`
+		// TrustedPeers file that the peers approved to join the cluster are stored in by the server
+		TrustedPeers string `toml:"trusted_peers"`
+		// AuditLog file that the server appends connection, focus and security events to
+		AuditLog string `toml:"audit_log"`
+	} `toml:"security"`
+
 	Server struct {
 		Port               int `toml:"port" validate:"required,min=1025,max=65535"`
 		WsWriteWaitSecond  int `toml:"soc_write_wait_second" validate:"required,min=1,max=30"`
 		WsCloseGracePeriod int `toml:"soc_close_grace_second" validate:"required,min=1,max=30"`
+		// DenyChords that the server refuses to forward to the given peers
+		DenyChords []ChordDenyList `toml:"deny_chords" validate:"dive"`
+		// LayoutFile the arrangement of the peers is kept in so that it survives a restart
+		LayoutFile string `toml:"layout_file"`
 	}
+
+	Transport struct {
+		// Udp sends input over a udp data channel alongside the websocket, both the server and the peer
+		// must enable it
+		Udp bool `toml:"udp"`
+		// UdpPort the server listens for the data channel on, defaults to the port after the web server
+		UdpPort int `toml:"udp_port" validate:"omitempty,min=1025,max=65535"`
+		// LossPercent of outgoing udp packets to drop on purpose, for testing retransmission
+		LossPercent int `toml:"loss_percent" validate:"min=0,max=100"`
+		// Direct lets peers send input straight to each other rather than relaying it through the server
+		Direct bool `toml:"direct"`
+		// DirectPort peers accept direct input on, defaults to two after the web server port
+		DirectPort int `toml:"direct_port" validate:"omitempty,min=1025,max=65535"`
+	} `toml:"transport"`
+
+	Helper struct {
+		// Socket of the privileged input helper, when set the input devices are owned by the helper and
+		// this process can run without access to them
+		Socket string `toml:"socket"`
+		// User that the unprivileged main process runs as, the helper only accepts connections from it
+		User string `toml:"user" validate:"required_with=Socket"`
+	} `toml:"helper"`
+
+	Peer struct {
+		// Role of the peer, full peers capture and forward their own input while receive peers only accept
+		// input from others
+		Role string `toml:"role" validate:"omitempty,oneof=full receive"`
+		// IdentityFile the peers uuid is kept in so that it keeps the same identity between runs
+		IdentityFile string `toml:"identity_file"`
+		// ReconnectAttempts to the last server before falling back to discovery when the connection drops
+		ReconnectAttempts int `toml:"reconnect_attempts" validate:"min=0,max=20"`
+		// Displays to report instead of querying the window server
+		Displays []StaticDisplay `toml:"displays" validate:"dive"`
+	} `toml:"peer"`
+
+	TextInput struct {
+		KeyDelayMs      int  `toml:"key_delay_ms" validate:"min=0,max=1000"`
+		UnicodeFallback bool `toml:"unicode_fallback"`
+	} `toml:"text_input"`
+
+	Gamepad struct {
+		Enabled bool               `toml:"enabled"`
+		Assign  []DeviceAssignment `toml:"assign" validate:"dive"`
+	} `toml:"gamepad"`
+
+	Touchpad struct {
+		Mode          string  `toml:"mode" validate:"omitempty,oneof=off raw scroll"`
+		Speed         float64 `toml:"speed" validate:"omitempty,min=0.1,max=10"`
+		NaturalScroll bool    `toml:"natural_scroll"`
+	} `toml:"touchpad"`
+
+	Tablet struct {
+		Enabled bool `toml:"enabled"`
+	} `toml:"tablet"`
+
+	Devices struct {
+		Rules []DeviceRule `toml:"rule" validate:"dive"`
+	} `toml:"devices"`
+
+	LocalKeys struct {
+		// Keys that are never forwarded while controlling another peer
+		Keys []string `toml:"keys"`
+		// MediaKeys are always routed to the media host
+		MediaKeys []string `toml:"media_keys"`
+		// MediaHost hostname of the peer that media keys are routed to
+		MediaHost string `toml:"media_host" validate:"required_with=MediaKeys"`
+	} `toml:"local_keys"`
+
+	Keyboard struct {
+		RepeatMode string `toml:"repeat_mode" validate:"omitempty,oneof=source target"`
+	} `toml:"keyboard"`
+
+	Focus struct {
+		// KeyboardNext moves keyboard focus to the next peer leaving the pointer where it is
+		KeyboardNext string `toml:"keyboard_next"`
+		// KeyboardReset returns keyboard focus to the peer with the pointer
+		KeyboardReset string `toml:"keyboard_reset"`
+		// Home returns focus to this peer from wherever it is, for targets that cant track their pointer
+		Home string `toml:"home"`
+		// Conflict policy for when two source peers want focus on the same peer
+		Conflict string `toml:"conflict" validate:"omitempty,oneof=first share deny"`
+	} `toml:"focus"`
+
+	Broadcast struct {
+		// Hotkey that toggles broadcasting this peers keyboard
+		Hotkey string `toml:"hotkey"`
+		// Peers hostnames that keyboard input is broadcast to, all peers if empty
+		Peers []string `toml:"peers"`
+		// TimeoutSeconds before broadcasting stops on its own
+		TimeoutSeconds int `toml:"timeout_seconds" validate:"min=0"`
+	} `toml:"broadcast"`
+
+	Macros struct {
+		File        string `toml:"file"`
+		RecordChord string `toml:"record_chord"`
+	} `toml:"macros"`
+}
+
+// Peer roles
+const (
+	PeerRoleFull    = "full"
+	PeerRoleReceive = "receive"
+)
+
+// Touchpad forwarding modes
+const (
+	TouchpadModeOff    = "off"
+	TouchpadModeRaw    = "raw"
+	TouchpadModeScroll = "scroll"
+)
+
+// Focus conflict policies
+const (
+	FocusConflictFirst = "first"
+	FocusConflictShare = "share"
+	FocusConflictDeny  = "deny"
+)
+
+// Key repeat modes
+const (
+	RepeatModeSource = "source"
+	RepeatModeTarget = "target"
+)
+
+// ChordDenyList is a list of key chords that are never forwarded to a peer
+type ChordDenyList struct {
+	// Peer hostname the list applies to, * applies it to every peer
+	Peer   string   `toml:"peer" validate:"required"`
+	Chords []string `toml:"chords" validate:"min=1"`
+}
+
+// StaticDisplay describes a display for peers without a window server that can be queried
+type StaticDisplay struct {
+	X      int `toml:"x"`
+	Y      int `toml:"y"`
+	Width  int `toml:"width" validate:"required,min=1"`
+	Height int `toml:"height" validate:"required,min=1"`
+}
+
+// DeviceAssignment routes a local device to a specific peer in the cluster
+type DeviceAssignment struct {
+	// Device name or path as reported by evdev
+	Device string `toml:"device" validate:"required"`
+	// Peer hostname that the device will be forwarded to
+	Peer string `toml:"peer" validate:"required"`
+}
+
+// DeviceRule pins a local keyboard/mouse style device to a peer or keeps it local
+type DeviceRule struct {
+	// Device name or path as reported by evdev
+	Device string `toml:"device" validate:"required"`
+	// Peer hostname that the device is always forwarded to, if empty the device is never forwarded
+	Peer string `toml:"peer"`
 }
 
 // Load the config from file and validate its contents
@@ -47,6 +220,11 @@ func Load() *Config {
 		return nil
 	}
 
+	// configs from before the secret was introduced wont have one, say so rather than leaving it to the validator
+	if len(config.Security.ClusterSecret) < 16 {
+		Log("config", "[security] cluster_secret must be at least 16 characters and the same on every peer")
+	}
+
 	v := validator.New()
 	if err := v.Struct(config); err != nil {
 		Logf("config", "invalid config: %s", err)
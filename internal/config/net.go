@@ -4,7 +4,7 @@ import "time"
 
 // Socket server
 const (
-	MaxMessageSize = 8192
+	MaxMessageSize = 1 << 16
 	PongWait       = 60 * time.Second
 	PingPeriod     = (PongWait * 9) / 10
 )
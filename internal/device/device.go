@@ -4,9 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/config"
 	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
 )
 
 type Device interface {
@@ -33,27 +37,109 @@ type DevicePlus interface {
 	MoveCursor(move common.Vector2)
 }
 
+// MirroredDevice is a local device whose events are sent wholesale to a matching virtual
+// device on another peer rather than following focus
+type MirroredDevice struct {
+	Device
+	// Info describes the device so that a matching virtual device can be created on the target peer
+	Info *events.DeviceAttached
+}
+
+// FollowsFocus reports if the device is sent to the focused peer rather than a fixed one
+func (md *MirroredDevice) FollowsFocus() bool {
+	return md.Info.Target == ""
+}
+
+// PinnedDevice is a local device whose input is always sent to the same peer regardless of focus
+type PinnedDevice struct {
+	Device
+	// Peer hostname the device is pinned to
+	Peer string
+}
+
+// number of incomming frames that can back up before the sender blocks
+const inputBufferSize = 64
+
+// Manager is everything the app needs from the local devices
+// it is implemented by the DeviceManager and by the client of a privileged helper process that owns one
+type Manager interface {
+	// IO gives the streams that input flows through
+	IO() *Streams
+	GrabAccess() error
+	GrabKeyboards() error
+	ReleaseAccess() error
+	Close() error
+	MirroredDevices() []*events.DeviceAttached
+	AttachMirror(info *events.DeviceAttached) error
+	DetachMirror(source uuid.UUID, id string) error
+	MoveCursor(delta common.Vector2)
+	KeyRepeat() events.KeyRepeat
+	SetKeyRepeat(repeat events.KeyRepeat)
+	TypeText(text string, keymap KeyMap, delay time.Duration, fallback bool)
+}
+
+// Streams are the channels that input flows through between the devices and the app
+type Streams struct {
+	// Events stream from grabbed devices to be consumed externally, a frame at a time
+	Events chan *events.InputFrame
+	// Input frames from external server to be passed to the vdev
+	Input chan *events.InputFrame
+	// Mirrored stream of DeviceInput and DeviceDetached messages from local devices that are mirrored on
+	// other peers
+	Mirrored chan events.WsMessage
+	// MirrorInput events from other peers to be passed to their mirror devices
+	MirrorInput chan *events.DeviceInput
+}
+
+// NewStreams sets up the channels for a manager
+func NewStreams() Streams {
+	return Streams{
+		Events:      make(chan *events.InputFrame),
+		Input:       make(chan *events.InputFrame, inputBufferSize),
+		Mirrored:    make(chan events.WsMessage),
+		MirrorInput: make(chan *events.DeviceInput),
+	}
+}
+
+// IO gives the streams that input flows through
+func (s *Streams) IO() *Streams {
+	return s
+}
+
 type DeviceManager struct {
-	// Events stream from grabbed devices to be consumed externally
-	Events chan *events.InputEvent
-	// Input events from external server to be passed to the vdev
-	Input chan *events.InputEvent
+	Streams
 
 	// grabbed state of watched devices
 	grabbed bool
-	// devices currently being watched
+	// devices currently being watched, these follow focus
 	devices []Device
+	// devices that are permanently grabbed and routed to a single peer
+	pinned []*PinnedDevice
 	// virtual device used for incomming events from peers
 	virtualDev DevicePlus
-	mux        sync.Mutex
-	ctx        *common.Context
+	// local devices that are mirrored on other peers
+	mirrored []*MirroredDevice
+	// virtual devices mirroring devices on other peers
+	mirrors map[string]Device
+	// ensures that frames are written to the virtual device without being interleaved
+	writeMux sync.Mutex
+	mux      sync.Mutex
+	ctx      *common.Context
 }
 
+var _ Manager = (*DeviceManager)(nil)
+
 // NewDeviceManager constructor
+// peers in the receive role only create the virtual device, local input devices are left alone
 func NewDeviceManager(ctx *common.Context) (*DeviceManager, error) {
-	devices := FindObservableDevices()
-	if len(devices) == 0 {
-		return nil, errors.New("no observable devices found")
+	receiveOnly := ctx.Config.Peer.Role == config.PeerRoleReceive
+
+	var devices []Device
+	if !receiveOnly {
+		devices = FindObservableDevices()
+		if len(devices) == 0 {
+			return nil, errors.New("no observable devices found")
+		}
 	}
 
 	vdev, err := CreateVirtualDevice()
@@ -62,16 +148,16 @@ func NewDeviceManager(ctx *common.Context) (*DeviceManager, error) {
 	}
 
 	dm := &DeviceManager{
-		Events: make(chan *events.InputEvent),
-		Input:  make(chan *events.InputEvent),
+		Streams: NewStreams(),
 
 		ctx:        ctx,
 		devices:    devices,
 		virtualDev: vdev,
+		mirrors:    make(map[string]Device),
 	}
 
-	for _, dev := range dm.devices {
-		go dm.trackEvents(dev)
+	if !receiveOnly {
+		dm.watchLocalDevices()
 	}
 
 	go dm.consumeIncommingEvents()
@@ -79,16 +165,77 @@ func NewDeviceManager(ctx *common.Context) (*DeviceManager, error) {
 	return dm, nil
 }
 
+// watchLocalDevices sets up the configured special devices and starts reading input from all of them
+func (dm *DeviceManager) watchLocalDevices() {
+	conf := dm.ctx.Config
+
+	if conf.Gamepad.Enabled {
+		dm.mirrored = assignDevices(FindGamepads(), conf.Gamepad.Assign)
+	}
+
+	if conf.Tablet.Enabled {
+		dm.mirrored = append(dm.mirrored, FindTablets()...)
+	}
+
+	switch conf.Touchpad.Mode {
+	case config.TouchpadModeRaw:
+		dm.mirrored = append(dm.mirrored, FindTouchpads()...)
+
+	case config.TouchpadModeScroll:
+		for _, touchpad := range FindTouchpads() {
+			dm.devices = append(dm.devices, NewScrollTouchpad(touchpad, conf))
+		}
+	}
+
+	dm.devices, dm.pinned = applyDeviceRules(dm.devices, conf.Devices.Rules)
+
+	for _, dev := range dm.devices {
+		go dm.trackEvents(dev, "")
+	}
+
+	for _, dev := range dm.pinned {
+		go dm.trackEvents(dev.Device, dev.Peer)
+	}
+
+	for _, dev := range dm.mirrored {
+		go dm.trackMirroredEvents(dev)
+	}
+}
+
 // GrabAccess exclusive access to all the devices being watched
 // this will stop rative input events being handled by any other program/service on the machine
 func (dm *DeviceManager) GrabAccess() error {
 	var err error
-	dm.grabbed = true
+	dm.setGrabbed(true)
 
 	for _, dev := range dm.devices {
 		err = common.WrapError(err, dev.Grab())
 	}
 
+	for _, dev := range dm.mirrored {
+		if dev.FollowsFocus() {
+			err = common.WrapError(err, dev.Grab())
+		}
+	}
+
+	if err != nil {
+		dm.ReleaseAccess()
+	}
+
+	return err
+}
+
+// GrabKeyboards grabs exclusive access to the keyboards being watched leaving pointer devices
+// under local control
+func (dm *DeviceManager) GrabKeyboards() error {
+	var err error
+
+	for _, dev := range dm.devices {
+		if keyboard, ok := dev.(interface{ IsKeyboard() bool }); ok && keyboard.IsKeyboard() {
+			err = common.WrapError(err, dev.Grab())
+		}
+	}
+
 	if err != nil {
 		dm.ReleaseAccess()
 	}
@@ -106,11 +253,24 @@ func (dm *DeviceManager) ReleaseAccess() error {
 		err = common.WrapError(err, dev.Release())
 	}
 
-	dm.grabbed = false
+	for _, dev := range dm.mirrored {
+		if dev.FollowsFocus() {
+			err = common.WrapError(err, dev.Release())
+		}
+	}
+
+	dm.setGrabbed(false)
 
 	return err
 }
 
+// setGrabbed records the grab state under the lock as the device readers check it
+func (dm *DeviceManager) setGrabbed(grabbed bool) {
+	dm.mux.Lock()
+	dm.grabbed = grabbed
+	dm.mux.Unlock()
+}
+
 // Close all the wacthed devices
 func (dm *DeviceManager) Close() error {
 	var err error
@@ -120,12 +280,80 @@ func (dm *DeviceManager) Close() error {
 		err = common.WrapError(err, dev.Close())
 	}
 
+	for _, dev := range dm.mirrored {
+		err = common.WrapError(err, dev.Release())
+		err = common.WrapError(err, dev.Close())
+	}
+
+	for _, dev := range dm.pinned {
+		err = common.WrapError(err, dev.Release())
+		err = common.WrapError(err, dev.Close())
+	}
+
+	for _, dev := range dm.mirrors {
+		err = common.WrapError(err, dev.Close())
+	}
+
 	err = common.WrapError(err, dm.virtualDev.Release())
 	err = common.WrapError(err, dm.virtualDev.Close())
 
 	return err
 }
 
+// MirroredDevices gives the details of all the local devices that are to be mirrored on other peers
+func (dm *DeviceManager) MirroredDevices() []*events.DeviceAttached {
+	dm.mux.Lock()
+	defer dm.mux.Unlock()
+
+	infos := make([]*events.DeviceAttached, 0, len(dm.mirrored))
+	for _, dev := range dm.mirrored {
+		infos = append(infos, dev.Info)
+	}
+
+	return infos
+}
+
+// AttachMirror creates a virtual device mirroring a device on another peer
+func (dm *DeviceManager) AttachMirror(info *events.DeviceAttached) error {
+	dm.mux.Lock()
+	defer dm.mux.Unlock()
+
+	key := mirrorKey(info.Source, info.ID)
+	if _, ok := dm.mirrors[key]; ok {
+		return nil
+	}
+
+	create := CreateMirrorDevice
+	if info.Class == events.DeviceClassTablet {
+		create = CreateMappedTablet
+	}
+
+	dev, err := create(info)
+	if err != nil {
+		return fmt.Errorf("failed to create mirror device: %w", err)
+	}
+
+	dm.mirrors[key] = dev
+
+	return nil
+}
+
+// DetachMirror removes the virtual device mirroring a device on another peer
+func (dm *DeviceManager) DetachMirror(source uuid.UUID, id string) error {
+	dm.mux.Lock()
+	defer dm.mux.Unlock()
+
+	key := mirrorKey(source, id)
+	dev, ok := dm.mirrors[key]
+	if !ok {
+		return nil
+	}
+
+	delete(dm.mirrors, key)
+
+	return dev.Close()
+}
+
 // Watch an aditional device
 func (dm *DeviceManager) Watch(newDev Device) {
 	dm.mux.Lock()
@@ -165,30 +393,213 @@ func (dm *DeviceManager) Forget(newDev Device) {
 
 // MoveCursor relative to its current position
 func (dm *DeviceManager) MoveCursor(delta common.Vector2) {
+	dm.writeMux.Lock()
+	defer dm.writeMux.Unlock()
+
 	dm.virtualDev.MoveCursor(delta)
 }
 
-func (dm *DeviceManager) trackEvents(dev Device) {
+// trackEvents reads events from the device and sends them out a frame at a time
+// frames from pinned devices are tagged with the peer they are pinned to
+func (dm *DeviceManager) trackEvents(dev Device, target string) {
 	defer dm.Forget(dev)
 
+	var frame []events.InputEvent
+
 	for {
 		event, err := dev.Read()
 		if err != nil {
 			return
 		}
 
-		dm.Events <- event
+		frame = append(frame, *event)
+		if !IsSynReport(event) {
+			continue
+		}
+
+		dm.Events <- &events.InputFrame{Events: frame, Target: target}
+		frame = nil
 	}
 }
 
 func (dm *DeviceManager) consumeIncommingEvents() {
+	var next *events.InputFrame
+
 	for {
+		frame := next
+		next = nil
+
+		if frame == nil {
+			select {
+			case <-dm.ctx.Done():
+				return
+
+			case frame = <-dm.Input:
+
+			case ev := <-dm.MirrorInput:
+				dm.writeMirror(ev)
+				continue
+			}
+		}
+
+		frame, next = coalesceMotion(frame, dm.Input)
+		dm.writeFrame(frame)
+	}
+}
+
+// writeFrame to the virtual device in one go
+func (dm *DeviceManager) writeFrame(frame *events.InputFrame) {
+	dm.writeMux.Lock()
+	defer dm.writeMux.Unlock()
+
+	for i := range frame.Events {
+		dm.virtualDev.Write(&frame.Events[i])
+	}
+}
+
+// coalesceMotion merges any motion frames that have backed up in the queue behind the given frame
+// the first non motion frame found is returned as next so it can be handled in order
+func coalesceMotion(frame *events.InputFrame, queue chan *events.InputFrame) (merged, next *events.InputFrame) {
+	for frame.IsMotion() {
 		select {
-		case <-dm.ctx.Done():
+		case queued := <-queue:
+			if !queued.IsMotion() {
+				return frame, queued
+			}
+
+			frame = frame.Merge(queued)
+
+		default:
+			return frame, nil
+		}
+	}
+
+	return frame, nil
+}
+
+// trackMirroredEvents reads events from a mirrored device and sends them out a frame at a time
+func (dm *DeviceManager) trackMirroredEvents(dev *MirroredDevice) {
+	var frame []events.InputEvent
+
+	for {
+		event, err := dev.Read()
+		if err != nil {
+			Logf("device", "mirrored device lost: %s", dev.Info.Name)
+			dm.Mirrored <- &events.DeviceDetached{ID: dev.Info.ID}
 			return
+		}
 
-		case ev := <-dm.Input:
-			dm.virtualDev.Write(ev)
+		frame = append(frame, *event)
+		if !IsSynReport(event) {
+			continue
+		}
+
+		dm.mux.Lock()
+		grabbed := dm.grabbed
+		dm.mux.Unlock()
+
+		// devices that follow focus are only forwarded while this peer has control of another
+		if dev.FollowsFocus() && !grabbed {
+			frame = nil
+			continue
 		}
+
+		dm.Mirrored <- &events.DeviceInput{
+			ID:     dev.Info.ID,
+			Events: frame,
+		}
+		frame = nil
+	}
+}
+
+// writeMirror passes a frame of events to the mirror of a device on another peer
+func (dm *DeviceManager) writeMirror(input *events.DeviceInput) {
+	dm.mux.Lock()
+	dev, ok := dm.mirrors[mirrorKey(input.Source, input.ID)]
+	dm.mux.Unlock()
+
+	if !ok {
+		return
 	}
+
+	for i := range input.Events {
+		dev.Write(&input.Events[i])
+	}
+}
+
+// applyDeviceRules splits the devices by the configured affinity rules
+// devices pinned to a peer are grabbed for good so that their events never reach this peer, devices
+// that should never be forwarded are closed and left for local use
+func applyDeviceRules(devices []Device, rules []config.DeviceRule) (pooled []Device, pinned []*PinnedDevice) {
+	for _, dev := range devices {
+		rule := matchDeviceRule(dev, rules)
+		switch {
+		case rule == nil:
+			pooled = append(pooled, dev)
+
+		case rule.Peer == "":
+			Logf("device", "keeping device local: %s", dev.ID())
+			dev.Close()
+
+		default:
+			if err := dev.Grab(); err != nil {
+				Logf("device", "failed to grab %s: %s", dev.ID(), err)
+				pooled = append(pooled, dev)
+				continue
+			}
+
+			Logf("device", "pinning device %s to %s", dev.ID(), rule.Peer)
+			pinned = append(pinned, &PinnedDevice{Device: dev, Peer: rule.Peer})
+		}
+	}
+
+	return pooled, pinned
+}
+
+// matchDeviceRule finds the first rule matching the devices name or id
+func matchDeviceRule(dev Device, rules []config.DeviceRule) *config.DeviceRule {
+	var name string
+	if named, ok := dev.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+
+	for i, rule := range rules {
+		if rule.Device == dev.ID() || (name != "" && rule.Device == name) {
+			return &rules[i]
+		}
+	}
+
+	return nil
+}
+
+// assignDevices to their configured peers
+// devices without an assignment are closed and left for local use, assigned devices are grabbed so that
+// their events only reach the target peer
+func assignDevices(devices []*MirroredDevice, assignments []config.DeviceAssignment) (assigned []*MirroredDevice) {
+	for _, dev := range devices {
+		for _, assignment := range assignments {
+			if assignment.Device != dev.Info.Name && assignment.Device != dev.ID() {
+				continue
+			}
+
+			if err := dev.Grab(); err != nil {
+				Logf("device", "failed to grab %s: %s", dev.Info.Name, err)
+				break
+			}
+
+			dev.Info.Target = assignment.Peer
+			assigned = append(assigned, dev)
+			break
+		}
+
+		if dev.Info.Target == "" {
+			dev.Close()
+		}
+	}
+
+	return assigned
+}
+
+func mirrorKey(source uuid.UUID, id string) string {
+	return source.String() + "|" + id
 }
@@ -3,9 +3,11 @@ package device
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/holoplot/go-evdev"
 	"github.com/indeedhat/harmony/internal/common"
@@ -91,6 +93,42 @@ func (evd *EvdevDevice) ID() string {
 	return evd.dev.Path()
 }
 
+// Name of the device as reported by the kernel
+func (evd *EvdevDevice) Name() string {
+	name, _ := evd.dev.Name()
+	return name
+}
+
+// IsKeyboard reports if the device has the keys of a typing keyboard
+func (evd *EvdevDevice) IsKeyboard() bool {
+	for _, code := range evd.dev.CapableEvents(evdev.EV_KEY) {
+		if code == evdev.KEY_SPACE {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eviocgrep ioctl request for reading a devices key repeat settings, see linux/input.h
+const eviocgrep = 0x80084503
+
+// RepeatSettings reads the key repeat delay and period (in ms) from the device
+func (evd *EvdevDevice) RepeatSettings() (delay, period int32, err error) {
+	file, err := os.Open(evd.dev.Path())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var rep [2]uint32
+	if err := ioctl(file, eviocgrep, uintptr(unsafe.Pointer(&rep))); err != nil {
+		return 0, 0, err
+	}
+
+	return int32(rep[0]), int32(rep[1]), nil
+}
+
 type EvdevDevicePlus struct {
 	EvdevDevice
 }
@@ -127,6 +165,51 @@ func (edp *EvdevDevicePlus) MoveCursor(move common.Vector2) {
 
 // FindObservableDevices thot have key or rel events
 func FindObservableDevices() (observable []Device) {
+	for _, dev := range openInputDevices(isObservable) {
+		observable = append(observable, &EvdevDevice{dev})
+	}
+
+	return observable
+}
+
+// FindGamepads that have absolute axes along with gamepad or joystick buttons
+func FindGamepads() (gamepads []*MirroredDevice) {
+	for _, dev := range openInputDevices(isGamepad) {
+		gamepads = append(gamepads, &MirroredDevice{
+			Device: &EvdevDevice{dev},
+			Info:   describeDevice(dev, events.DeviceClassGamepad),
+		})
+	}
+
+	return gamepads
+}
+
+// FindTouchpads that report multi touch slots
+func FindTouchpads() (touchpads []*MirroredDevice) {
+	for _, dev := range openInputDevices(isTouchpad) {
+		touchpads = append(touchpads, &MirroredDevice{
+			Device: &EvdevDevice{dev},
+			Info:   describeDevice(dev, events.DeviceClassTouchpad),
+		})
+	}
+
+	return touchpads
+}
+
+// FindTablets that report pen position and pressure
+func FindTablets() (tablets []*MirroredDevice) {
+	for _, dev := range openInputDevices(isTablet) {
+		tablets = append(tablets, &MirroredDevice{
+			Device: &EvdevDevice{dev},
+			Info:   describeDevice(dev, events.DeviceClassTablet),
+		})
+	}
+
+	return tablets
+}
+
+// openInputDevices opens all the input devices that pass the filter
+func openInputDevices(filter func(*evdev.InputDevice) bool) (devices []*evdev.InputDevice) {
 	basePath := "/dev/input"
 
 	files, err := ioutil.ReadDir(basePath)
@@ -146,15 +229,15 @@ func FindObservableDevices() (observable []Device) {
 			continue
 		}
 
-		if !isObservable(dev) {
+		if !filter(dev) {
 			dev.Close()
 			continue
 		}
 
-		observable = append(observable, &EvdevDevice{dev})
+		devices = append(devices, dev)
 	}
 
-	return observable
+	return devices
 }
 
 func isObservable(dev *evdev.InputDevice) bool {
@@ -178,6 +261,98 @@ func isObservable(dev *evdev.InputDevice) bool {
 	return false
 }
 
+func isGamepad(dev *evdev.InputDevice) bool {
+	if len(dev.CapableEvents(evdev.EV_ABS)) == 0 {
+		return false
+	}
+
+	for _, event := range dev.CapableEvents(evdev.EV_KEY) {
+		if event == evdev.BTN_GAMEPAD || event == evdev.BTN_JOYSTICK {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTouchpad(dev *evdev.InputDevice) bool {
+	var mt, finger, pen bool
+
+	for _, event := range dev.CapableEvents(evdev.EV_ABS) {
+		if event == evdev.ABS_MT_POSITION_X {
+			mt = true
+		}
+	}
+
+	for _, event := range dev.CapableEvents(evdev.EV_KEY) {
+		switch event {
+		case evdev.BTN_TOOL_FINGER:
+			finger = true
+		case evdev.BTN_TOOL_PEN:
+			pen = true
+		}
+	}
+
+	return mt && finger && !pen
+}
+
+func isTablet(dev *evdev.InputDevice) bool {
+	var pen, pressure bool
+
+	for _, event := range dev.CapableEvents(evdev.EV_KEY) {
+		if event == evdev.BTN_TOOL_PEN {
+			pen = true
+		}
+	}
+
+	for _, event := range dev.CapableEvents(evdev.EV_ABS) {
+		if event == evdev.ABS_PRESSURE {
+			pressure = true
+		}
+	}
+
+	return pen && pressure
+}
+
+// describeDevice builds the info needed for another peer to create a mirror of the device
+func describeDevice(dev *evdev.InputDevice, class events.DeviceClass) *events.DeviceAttached {
+	name, _ := dev.Name()
+	id, _ := dev.InputID()
+
+	info := &events.DeviceAttached{
+		ID:           dev.Path(),
+		Name:         name,
+		Class:        class,
+		BusType:      id.BusType,
+		Vendor:       id.Vendor,
+		Product:      id.Product,
+		Version:      id.Version,
+		Capabilities: make(map[uint16][]uint16),
+		AbsInfo:      make(map[uint16]events.AbsInfo),
+	}
+
+	// force feedback and led events need a return path to the source device so are not mirrored
+	for _, typ := range []evdev.EvType{evdev.EV_KEY, evdev.EV_REL, evdev.EV_ABS, evdev.EV_MSC} {
+		for _, code := range dev.CapableEvents(typ) {
+			info.Capabilities[uint16(typ)] = append(info.Capabilities[uint16(typ)], uint16(code))
+		}
+	}
+
+	absInfos, _ := dev.AbsInfos()
+	for code, absInfo := range absInfos {
+		info.AbsInfo[uint16(code)] = events.AbsInfo{
+			Value:      absInfo.Value,
+			Minimum:    absInfo.Minimum,
+			Maximum:    absInfo.Maximum,
+			Fuzz:       absInfo.Fuzz,
+			Flat:       absInfo.Flat,
+			Resolution: absInfo.Resolution,
+		}
+	}
+
+	return info
+}
+
 // CreateVirtualDevice that has as much mouse/keyboard capability as possible
 // This can be used to pipe all recieved events through on a client machine
 func CreateVirtualDevice() (DevicePlus, error) {
@@ -187,6 +362,8 @@ func CreateVirtualDevice() (DevicePlus, error) {
 		Product: 0x0816,
 		Version: 1,
 	}, map[evdev.EvType][]evdev.EvCode{
+		// repeat is enabled so that the peer giving focus can choose to use the kernels soft repeat
+		evdev.EV_REP: {},
 		evdev.EV_REL: {
 			evdev.REL_X,
 			evdev.REL_Y,
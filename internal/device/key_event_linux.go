@@ -14,3 +14,33 @@ func IsAltUpEvent(ev *events.InputEvent) bool {
 		ev.Type == evdev.EV_KEY &&
 		(ev.Code == evdev.KEY_LEFTALT || ev.Code == evdev.KEY_RIGHTALT)
 }
+
+// IsKeyEvent checks if the event is a key or button press/release/repeat
+func IsKeyEvent(ev *events.InputEvent) bool {
+	return ev.Type == evdev.EV_KEY
+}
+
+// IsSynReport checks if the event marks the end of a frame of events
+func IsSynReport(ev *events.InputEvent) bool {
+	return ev.Type == evdev.EV_SYN && ev.Code == evdev.SYN_REPORT
+}
+
+// DropKeyRepeats removes key repeat events from the frame
+// if nothing but the sync report is left then nil is returned
+func DropKeyRepeats(frame *events.InputFrame) *events.InputFrame {
+	filtered := &events.InputFrame{}
+
+	for _, event := range frame.Events {
+		if event.Type == evdev.EV_KEY && event.Value == 2 {
+			continue
+		}
+
+		filtered.Events = append(filtered.Events, event)
+	}
+
+	if len(filtered.Events) == 1 && IsSynReport(&filtered.Events[0]) {
+		return nil
+	}
+
+	return filtered
+}
@@ -0,0 +1,51 @@
+package device
+
+// KeyStroke describes the key and modifiers required to produce a single character
+type KeyStroke struct {
+	// Code of the key on the input device
+	Code uint16
+	// Shift needs to be held while pressing the key
+	Shift bool
+	// AltGr (level 3 shift) needs to be held while pressing the key
+	AltGr bool
+}
+
+// KeyMap maps characters to the key strokes that produce them on the local keyboard layout
+type KeyMap map[rune]KeyStroke
+
+// usRows of the us layout, each string holds the characters of consecutive key codes starting at code
+var usRows = []struct {
+	code    uint16
+	plain   string
+	shifted string
+}{
+	// KEY_1 to KEY_EQUAL
+	{2, "1234567890-=", "!@#$%^&*()_+"},
+	// KEY_Q to KEY_RIGHTBRACE
+	{16, "qwertyuiop[]", "QWERTYUIOP{}"},
+	// KEY_A to KEY_GRAVE
+	{30, "asdfghjkl;'`", "ASDFGHJKL:\"~"},
+	// KEY_BACKSLASH to KEY_SLASH
+	{43, "\\zxcvbnm,./", "|ZXCVBNM<>?"},
+}
+
+// DefaultKeyMap for peers that cannot query their layout, it assumes a us keyboard
+func DefaultKeyMap() KeyMap {
+	keymap := KeyMap{
+		' ':  {Code: 57},
+		'\n': {Code: 28},
+		'\t': {Code: 15},
+	}
+
+	for _, row := range usRows {
+		for i, char := range row.plain {
+			keymap[char] = KeyStroke{Code: row.code + uint16(i)}
+		}
+
+		for i, char := range row.shifted {
+			keymap[char] = KeyStroke{Code: row.code + uint16(i), Shift: true}
+		}
+	}
+
+	return keymap
+}
@@ -0,0 +1,223 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// ParseChord parses key names joined by + into their key codes
+// eg. KEY_LEFTCTRL+KEY_LEFTALT+KEY_DELETE
+func ParseChord(chord string) ([]uint16, error) {
+	var codes []uint16
+
+	for _, name := range strings.Split(chord, "+") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		code, ok := evdev.KEYFromString[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %s", name)
+		}
+
+		codes = append(codes, uint16(code))
+	}
+
+	return codes, nil
+}
+
+// KeySet is a set of key codes
+type KeySet map[uint16]bool
+
+// ParseKeySet parses a list of key names into a set of key codes
+func ParseKeySet(names []string) (KeySet, error) {
+	set := make(KeySet, len(names))
+
+	for _, name := range names {
+		codes, err := ParseChord(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, code := range codes {
+			set[code] = true
+		}
+	}
+
+	return set, nil
+}
+
+// Split the key events for keys in the set out of the frame
+// both of the returned frames end with the original sync report, either will be nil if it would
+// have no other events in it
+func (ks KeySet) Split(frame *events.InputFrame) (matched, rest *events.InputFrame) {
+	if len(ks) == 0 {
+		return nil, frame
+	}
+
+	return splitFrame(frame, func(event *events.InputEvent) bool {
+		return event.Type == evdev.EV_KEY && ks[event.Code]
+	})
+}
+
+// SplitPointer separates pointer motion and buttons from the keyboard events in a frame
+// either of the returned frames will be nil if it would have no events other than the sync report
+func SplitPointer(frame *events.InputFrame) (keyboard, pointer *events.InputFrame) {
+	pointer, keyboard = splitFrame(frame, isPointerEvent)
+	return keyboard, pointer
+}
+
+// isPointerEvent checks if the event is pointer motion, scrolling or a mouse button
+func isPointerEvent(event *events.InputEvent) bool {
+	switch event.Type {
+	case evdev.EV_REL, evdev.EV_ABS:
+		return true
+	case evdev.EV_KEY:
+		return event.Code >= evdev.BTN_MISC && event.Code < evdev.KEY_OK
+	}
+
+	return false
+}
+
+// splitFrame into the events that match and those that dont
+// both of the returned frames end with the original sync report, either will be nil if it would
+// have no other events in it
+func splitFrame(frame *events.InputFrame, match func(*events.InputEvent) bool) (matched, rest *events.InputFrame) {
+	var (
+		syn      []events.InputEvent
+		inSet    []events.InputEvent
+		notInSet []events.InputEvent
+	)
+
+	for i, event := range frame.Events {
+		switch {
+		case IsSynReport(&event):
+			syn = append(syn, event)
+		case match(&frame.Events[i]):
+			inSet = append(inSet, event)
+		default:
+			notInSet = append(notInSet, event)
+		}
+	}
+
+	if len(inSet) == 0 {
+		return nil, frame
+	}
+
+	if len(notInSet) == 0 {
+		return frame, nil
+	}
+
+	matched = &events.InputFrame{Events: append(inSet, syn...), Target: frame.Target}
+	rest = &events.InputFrame{Events: append(notInSet, syn...), Target: frame.Target}
+
+	return matched, rest
+}
+
+// ChordString gives the human readable version of a chord
+func ChordString(chord []uint16) string {
+	names := make([]string, 0, len(chord))
+	for _, code := range chord {
+		names = append(names, evdev.KEYToString[evdev.EvCode(code)])
+	}
+
+	return strings.Join(names, "+")
+}
+
+// ChordTracker keeps track of which keys are being held so that key chords can be detected
+type ChordTracker struct {
+	held map[uint16]bool
+}
+
+// NewChordTracker constructor
+func NewChordTracker() *ChordTracker {
+	return &ChordTracker{
+		held: make(map[uint16]bool),
+	}
+}
+
+// Update the held keys from the event
+// it will return true if the event was a new key press
+func (ct *ChordTracker) Update(ev *events.InputEvent) bool {
+	if ev.Type != evdev.EV_KEY {
+		return false
+	}
+
+	switch ev.Value {
+	case 0:
+		delete(ct.held, ev.Code)
+	case 1:
+		ct.held[ev.Code] = true
+		return true
+	}
+
+	return false
+}
+
+// Contains reports if all of the keys in the chord are being held, other keys may be held too
+func (ct *ChordTracker) Contains(chord []uint16) bool {
+	if len(chord) == 0 {
+		return false
+	}
+
+	for _, code := range chord {
+		if !ct.held[code] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Held reports if exactly the keys in the chord are currently being held
+func (ct *ChordTracker) Held(chord []uint16) bool {
+	if len(chord) == 0 || len(chord) != len(ct.held) {
+		return false
+	}
+
+	for _, code := range chord {
+		if !ct.held[code] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// modifier keys that have a left and right variant
+var modifierPairs = map[uint16]uint16{
+	evdev.KEY_LEFTCTRL:   evdev.KEY_RIGHTCTRL,
+	evdev.KEY_LEFTALT:    evdev.KEY_RIGHTALT,
+	evdev.KEY_LEFTSHIFT:  evdev.KEY_RIGHTSHIFT,
+	evdev.KEY_LEFTMETA:   evdev.KEY_RIGHTMETA,
+	evdev.KEY_RIGHTCTRL:  evdev.KEY_LEFTCTRL,
+	evdev.KEY_RIGHTALT:   evdev.KEY_LEFTALT,
+	evdev.KEY_RIGHTSHIFT: evdev.KEY_LEFTSHIFT,
+	evdev.KEY_RIGHTMETA:  evdev.KEY_LEFTMETA,
+}
+
+// ChordVariants expands a chord into every combination of its left and right hand modifiers
+// so that KEY_LEFTCTRL+KEY_LEFTALT+KEY_DELETE also covers the same chord pressed with the right hand
+func ChordVariants(chord []uint16) [][]uint16 {
+	variants := [][]uint16{nil}
+
+	for _, code := range chord {
+		alt, ok := modifierPairs[code]
+
+		var next [][]uint16
+		for _, variant := range variants {
+			next = append(next, append(append([]uint16(nil), variant...), code))
+			if ok {
+				next = append(next, append(append([]uint16(nil), variant...), alt))
+			}
+		}
+
+		variants = next
+	}
+
+	return variants
+}
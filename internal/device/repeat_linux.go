@@ -0,0 +1,74 @@
+package device
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// kernel soft repeat defaults, used when the source keyboard cannot be queried
+const (
+	defaultRepeatDelayMs  = 250
+	defaultRepeatPeriodMs = 33
+)
+
+// KeyRepeat gives the key repeat settings that a peer recieving focus should use
+// based on the configured repeat mode
+func (dm *DeviceManager) KeyRepeat() events.KeyRepeat {
+	if dm.ctx.Config.Keyboard.RepeatMode != config.RepeatModeTarget {
+		return events.KeyRepeat{}
+	}
+
+	dm.mux.Lock()
+	defer dm.mux.Unlock()
+
+	for _, dev := range dm.devices {
+		evd, ok := dev.(*EvdevDevice)
+		if !ok {
+			continue
+		}
+
+		delay, period, err := evd.RepeatSettings()
+		if err != nil {
+			continue
+		}
+
+		return events.KeyRepeat{
+			Target:   true,
+			DelayMs:  delay,
+			PeriodMs: period,
+		}
+	}
+
+	return events.KeyRepeat{
+		Target:   true,
+		DelayMs:  defaultRepeatDelayMs,
+		PeriodMs: defaultRepeatPeriodMs,
+	}
+}
+
+// SetKeyRepeat updates the soft repeat on the virtual device
+// setting the repeat period to 0 disables the kernels repeat for the device entirely
+func (dm *DeviceManager) SetKeyRepeat(repeat events.KeyRepeat) {
+	var (
+		evTime = syscall.NsecToTimeval(time.Now().UnixNano())
+		delay  = int32(defaultRepeatDelayMs)
+		period int32
+	)
+
+	if repeat.Target {
+		delay = repeat.DelayMs
+		period = repeat.PeriodMs
+	}
+
+	dm.writeFrame(&events.InputFrame{
+		Events: []events.InputEvent{
+			{Time: evTime, Type: evdev.EV_REP, Code: evdev.REP_DELAY, Value: delay},
+			{Time: evTime, Type: evdev.EV_REP, Code: evdev.REP_PERIOD, Value: period},
+			{Time: evTime, Type: evdev.EV_SYN, Code: evdev.SYN_REPORT},
+		},
+	})
+}
@@ -0,0 +1,126 @@
+package device
+
+import (
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// axisMapping maps a region of a source axis onto a target range
+type axisMapping struct {
+	from int32
+	span float64
+	to   int32
+	size float64
+}
+
+// apply the mapping to a value from the source axis
+func (am axisMapping) apply(value int32) int32 {
+	mapped := am.to + int32(float64(value-am.from)*am.size/am.span)
+
+	if mapped < am.to {
+		return am.to
+	}
+
+	if max := am.to + int32(am.size); mapped > max {
+		return max
+	}
+
+	return mapped
+}
+
+// MappedTablet mirrors a tablet from another peer, mapping its pen position onto an area of the
+// local desktop
+//
+// the largest region of the tablet that matches the aspect ratio of the area is used so that
+// drawing is not stretched
+type MappedTablet struct {
+	Device
+
+	x axisMapping
+	y axisMapping
+}
+
+// CreateMappedTablet creates a virtual tablet whose absolute axes cover the area given by the source peer
+// if no area was provided then a plain mirror of the source tablet is created
+func CreateMappedTablet(info *events.DeviceAttached) (Device, error) {
+	area := info.Area
+	srcX, okX := info.AbsInfo[evdev.ABS_X]
+	srcY, okY := info.AbsInfo[evdev.ABS_Y]
+
+	if !okX || !okY || area.W <= area.X || area.Z <= area.Y ||
+		srcX.Maximum <= srcX.Minimum || srcY.Maximum <= srcY.Minimum {
+
+		return CreateMirrorDevice(info)
+	}
+
+	var (
+		areaW   = float64(area.W - area.X)
+		areaH   = float64(area.Z - area.Y)
+		regionW = float64(srcX.Maximum - srcX.Minimum)
+		regionH = float64(srcY.Maximum - srcY.Minimum)
+		fromX   = srcX.Minimum
+		fromY   = srcY.Minimum
+	)
+
+	// crop the tablet to the aspect ratio of the area, keeping the cropped region centered
+	if regionW/regionH > areaW/areaH {
+		cropped := regionH * areaW / areaH
+		fromX += int32((regionW - cropped) / 2)
+		regionW = cropped
+	} else {
+		cropped := regionW * areaH / areaW
+		fromY += int32((regionH - cropped) / 2)
+		regionH = cropped
+	}
+
+	tablet := &MappedTablet{
+		x: axisMapping{from: fromX, span: regionW, to: int32(area.X), size: areaW},
+		y: axisMapping{from: fromY, span: regionH, to: int32(area.Y), size: areaH},
+	}
+
+	mapped := *info
+	mapped.AbsInfo = make(map[uint16]events.AbsInfo, len(info.AbsInfo))
+	for code, absInfo := range info.AbsInfo {
+		mapped.AbsInfo[code] = absInfo
+	}
+
+	mapped.AbsInfo[evdev.ABS_X] = events.AbsInfo{
+		Minimum:    int32(area.X),
+		Maximum:    int32(area.W),
+		Resolution: int32(float64(srcX.Resolution) * areaW / regionW),
+	}
+	mapped.AbsInfo[evdev.ABS_Y] = events.AbsInfo{
+		Minimum:    int32(area.Y),
+		Maximum:    int32(area.Z),
+		Resolution: int32(float64(srcY.Resolution) * areaH / regionH),
+	}
+
+	dev, err := CreateMirrorDevice(&mapped)
+	if err != nil {
+		return nil, err
+	}
+
+	tablet.Device = dev
+
+	return tablet, nil
+}
+
+// Write an event to the device mapping the pen position onto the desktop area
+func (mt *MappedTablet) Write(event *events.InputEvent) error {
+	if event.Type != evdev.EV_ABS {
+		return mt.Device.Write(event)
+	}
+
+	mapped := *event
+
+	switch event.Code {
+	case evdev.ABS_X:
+		mapped.Value = mt.x.apply(event.Value)
+	case evdev.ABS_Y:
+		mapped.Value = mt.y.apply(event.Value)
+	}
+
+	return mt.Device.Write(&mapped)
+}
+
+var _ Device = (*MappedTablet)(nil)
@@ -0,0 +1,97 @@
+package device
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// hexKeys are used to enter unicode code points when the active layout does not provide the digits itself
+var hexKeys = map[rune]uint16{
+	'0': evdev.KEY_0, '1': evdev.KEY_1, '2': evdev.KEY_2, '3': evdev.KEY_3,
+	'4': evdev.KEY_4, '5': evdev.KEY_5, '6': evdev.KEY_6, '7': evdev.KEY_7,
+	'8': evdev.KEY_8, '9': evdev.KEY_9, 'a': evdev.KEY_A, 'b': evdev.KEY_B,
+	'c': evdev.KEY_C, 'd': evdev.KEY_D, 'e': evdev.KEY_E, 'f': evdev.KEY_F,
+}
+
+// TypeText converts the given text into key strokes for the local keyboard layout and writes
+// them to the virtual device with delay between each character
+//
+// characters that the layout cannot produce will be entered with the ctrl+shift+u unicode entry sequence
+// if fallback is enabled, otherwise they are skipped
+//
+// This will block until all the text has been typed
+func (dm *DeviceManager) TypeText(text string, keymap KeyMap, delay time.Duration, fallback bool) {
+	for _, char := range text {
+		select {
+		case <-dm.ctx.Done():
+			return
+		default:
+		}
+
+		if stroke, ok := keymap[char]; ok {
+			dm.writeKeyStroke(stroke)
+		} else if fallback {
+			dm.writeUnicodeSequence(char, keymap)
+		} else {
+			Logf("device", "no key stroke for character %U", char)
+		}
+
+		time.Sleep(delay)
+	}
+}
+
+// writeKeyStroke presses and releases a key along with any modifiers it requires
+func (dm *DeviceManager) writeKeyStroke(stroke KeyStroke) {
+	var modifiers []uint16
+	if stroke.Shift {
+		modifiers = append(modifiers, evdev.KEY_LEFTSHIFT)
+	}
+	if stroke.AltGr {
+		modifiers = append(modifiers, evdev.KEY_RIGHTALT)
+	}
+
+	dm.writeChord(append(modifiers, stroke.Code)...)
+}
+
+// writeUnicodeSequence enters a character by its code point using ctrl+shift+u <hex> space
+func (dm *DeviceManager) writeUnicodeSequence(char rune, keymap KeyMap) {
+	dm.writeChord(evdev.KEY_LEFTCTRL, evdev.KEY_LEFTSHIFT, evdev.KEY_U)
+
+	for _, digit := range fmt.Sprintf("%x", char) {
+		if stroke, ok := keymap[digit]; ok {
+			dm.writeKeyStroke(stroke)
+		} else {
+			dm.writeChord(hexKeys[digit])
+		}
+	}
+
+	dm.writeChord(evdev.KEY_SPACE)
+}
+
+// writeChord presses all the given keys in order then releases them in reverse order
+func (dm *DeviceManager) writeChord(codes ...uint16) {
+	for _, code := range codes {
+		dm.writeKey(code, 1)
+	}
+
+	for i := len(codes) - 1; i >= 0; i-- {
+		dm.writeKey(codes[i], 0)
+	}
+}
+
+// writeKey event followed by a sync report to the virtual device
+func (dm *DeviceManager) writeKey(code uint16, value int32) {
+	evTime := syscall.NsecToTimeval(time.Now().UnixNano())
+
+	dm.Input <- &events.InputFrame{
+		Events: []events.InputEvent{
+			{Time: evTime, Type: evdev.EV_KEY, Code: code, Value: value},
+			{Time: evTime, Type: evdev.EV_SYN, Code: evdev.SYN_REPORT},
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package device
+
+import (
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+const (
+	// fallback resolution (units per mm) for touchpads that dont report one
+	defaultTouchpadResolution = 10
+	// pixels of pointer motion per mm of finger motion before the speed multiplier is applied
+	touchpadPixelsPerMM = 8
+	// mm of two finger motion required for a single scroll wheel click
+	touchpadScrollMM = 3
+)
+
+type touch struct {
+	active bool
+	// set until the first frame the touch has been reported in has been processed
+	fresh bool
+	x     int32
+	y     int32
+	lastX int32
+	lastY int32
+}
+
+// ScrollTouchpad wraps a touchpad so that its multi touch frames are read as relative pointer motion
+// one finger moves the pointer, two fingers scroll
+//
+// this allows a touchpad to control peers without them needing a virtual touchpad
+type ScrollTouchpad struct {
+	Device
+
+	speed   float64
+	natural bool
+	res     float64
+
+	slot    int32
+	touches map[int32]*touch
+	// number of touches in the previous frame, motion is ignored for a frame when it changes
+	lastCount int
+	// sub pixel/click remainders carried over between frames
+	remX    float64
+	remY    float64
+	scrollX float64
+	scrollY float64
+	// translated events for the frame currently being read from the touchpad
+	frame []*events.InputEvent
+	// translated events from completed frames waiting to be read
+	pending []*events.InputEvent
+}
+
+// NewScrollTouchpad wraps a touchpad translating its touches into pointer and scroll wheel events
+func NewScrollTouchpad(dev *MirroredDevice, conf *config.Config) *ScrollTouchpad {
+	res := float64(dev.Info.AbsInfo[evdev.ABS_MT_POSITION_X].Resolution)
+	if res == 0 {
+		res = defaultTouchpadResolution
+	}
+
+	speed := conf.Touchpad.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	return &ScrollTouchpad{
+		Device:  dev.Device,
+		speed:   speed,
+		natural: conf.Touchpad.NaturalScroll,
+		res:     res,
+		touches: make(map[int32]*touch),
+	}
+}
+
+// Read the next translated event from the touchpad
+// this will block until the touchpad produces motion or a button event
+func (stp *ScrollTouchpad) Read() (*events.InputEvent, error) {
+	for len(stp.pending) == 0 {
+		event, err := stp.Device.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		stp.handle(event)
+	}
+
+	event := stp.pending[0]
+	stp.pending = stp.pending[1:]
+
+	return event, nil
+}
+
+// handle a raw event from the touchpad
+func (stp *ScrollTouchpad) handle(event *events.InputEvent) {
+	switch event.Type {
+	case evdev.EV_KEY:
+		switch event.Code {
+		case evdev.BTN_LEFT, evdev.BTN_RIGHT, evdev.BTN_MIDDLE:
+			stp.frame = append(stp.frame, event)
+		}
+
+	case evdev.EV_ABS:
+		current := stp.current()
+
+		switch event.Code {
+		case evdev.ABS_MT_SLOT:
+			stp.slot = event.Value
+		case evdev.ABS_MT_TRACKING_ID:
+			current.active = event.Value != -1
+			current.fresh = true
+		case evdev.ABS_MT_POSITION_X:
+			current.x = event.Value
+		case evdev.ABS_MT_POSITION_Y:
+			current.y = event.Value
+		}
+
+	case evdev.EV_SYN:
+		if event.Code == evdev.SYN_REPORT {
+			stp.handleFrame(event)
+		}
+	}
+}
+
+// handleFrame converts the touch state at the end of a frame into relative events
+func (stp *ScrollTouchpad) handleFrame(syn *events.InputEvent) {
+	var (
+		count  int
+		dx, dy float64
+	)
+
+	for _, t := range stp.touches {
+		if !t.active {
+			continue
+		}
+
+		count++
+		if !t.fresh {
+			dx += float64(t.x - t.lastX)
+			dy += float64(t.y - t.lastY)
+		}
+
+		t.fresh = false
+		t.lastX = t.x
+		t.lastY = t.y
+	}
+
+	// finger count changes would otherwise cause the pointer to jump
+	if count != stp.lastCount {
+		stp.lastCount = count
+		stp.remX, stp.remY, stp.scrollX, stp.scrollY = 0, 0, 0, 0
+		dx, dy = 0, 0
+	}
+
+	switch count {
+	case 1:
+		scale := touchpadPixelsPerMM * stp.speed / stp.res
+		stp.remX += dx * scale
+		stp.remY += dy * scale
+
+		stp.queueRel(syn, evdev.REL_X, &stp.remX)
+		stp.queueRel(syn, evdev.REL_Y, &stp.remY)
+
+	case 2:
+		// averaged over both fingers then converted into wheel clicks
+		scale := 1 / (2 * touchpadScrollMM * stp.res)
+		if !stp.natural {
+			scale = -scale
+		}
+
+		stp.scrollX -= dx * scale
+		stp.scrollY += dy * scale
+
+		stp.queueRel(syn, evdev.REL_HWHEEL, &stp.scrollX)
+		stp.queueRel(syn, evdev.REL_WHEEL, &stp.scrollY)
+	}
+
+	if len(stp.frame) > 0 {
+		stp.pending = append(stp.pending, append(stp.frame, syn)...)
+		stp.frame = nil
+	}
+}
+
+// queueRel event for the whole part of the accumulated value, the remainder is carried over
+func (stp *ScrollTouchpad) queueRel(syn *events.InputEvent, code uint16, acc *float64) {
+	value := int32(*acc)
+	if value == 0 {
+		return
+	}
+
+	*acc -= float64(value)
+	stp.frame = append(stp.frame, &events.InputEvent{
+		Time:  syn.Time,
+		Type:  evdev.EV_REL,
+		Code:  code,
+		Value: value,
+	})
+}
+
+func (stp *ScrollTouchpad) current() *touch {
+	t, ok := stp.touches[stp.slot]
+	if !ok {
+		t = &touch{}
+		stp.touches[stp.slot] = t
+	}
+
+	return t
+}
+
+var _ Device = (*ScrollTouchpad)(nil)
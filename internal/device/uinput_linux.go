@@ -0,0 +1,194 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/holoplot/go-evdev"
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// uinput ioctl requests, see linux/uinput.h
+const (
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiDevSetup   = 0x405c5503
+	uiAbsSetup   = 0x401c5504
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiSetRelBit  = 0x40045566
+	uiSetAbsBit  = 0x40045567
+	uiSetMscBit  = 0x40045568
+)
+
+type uinputSetup struct {
+	BusType      uint16
+	Vendor       uint16
+	Product      uint16
+	Version      uint16
+	Name         [80]byte
+	FFEffectsMax uint32
+}
+
+type uinputAbsSetup struct {
+	Code uint16
+	_    uint16
+	// events.AbsInfo shares its memory layout with the kernels input_absinfo struct
+	AbsInfo events.AbsInfo
+}
+
+type uinputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+var _ Device = (*UinputDevice)(nil)
+
+// UinputDevice is a write only virtual device created directly through /dev/uinput
+//
+// unlike the evdev virtual device it supports absolute axes which makes it suitable
+// for mirroring devices such as gamepads from other peers
+type UinputDevice struct {
+	name string
+	file *os.File
+}
+
+// CreateMirrorDevice creates a virtual device matching the one described by a peer
+func CreateMirrorDevice(info *events.DeviceAttached) (Device, error) {
+	file, err := os.OpenFile("/dev/uinput", syscall.O_WRONLY|syscall.O_NONBLOCK, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uinput: %w", err)
+	}
+
+	dev := &UinputDevice{
+		name: info.Name,
+		file: file,
+	}
+
+	if err := dev.setup(info); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return dev, nil
+}
+
+// Read is not supported on uinput devices
+func (uid *UinputDevice) Read() (*events.InputEvent, error) {
+	return nil, errors.New("uinput devices are write only")
+}
+
+// Write an event to the device
+func (uid *UinputDevice) Write(event *events.InputEvent) error {
+	ev := uinputEvent{
+		Time:  event.Time,
+		Type:  event.Type,
+		Code:  event.Code,
+		Value: event.Value,
+	}
+
+	_, err := uid.file.Write((*[unsafe.Sizeof(ev)]byte)(unsafe.Pointer(&ev))[:])
+	return err
+}
+
+// Grab is a noop for uinput devices
+func (uid *UinputDevice) Grab() error {
+	return nil
+}
+
+// Release is a noop for uinput devices
+func (uid *UinputDevice) Release() error {
+	return nil
+}
+
+// Close destroys the virtual device
+func (uid *UinputDevice) Close() error {
+	err := ioctl(uid.file, uiDevDestroy, 0)
+	return common.WrapError(err, uid.file.Close())
+}
+
+// String returns a string representation of the device
+// it conforms to fmt.Stringer
+func (uid *UinputDevice) String() string {
+	return fmt.Sprintf(`%s {
+    Name: "%s",
+}`, "UinputDevice", uid.name)
+}
+
+// ID returns a unique identifer for the underlying device
+func (uid *UinputDevice) ID() string {
+	return uid.file.Name() + ":" + uid.name
+}
+
+// setup registers the devices capabilities with uinput and creates it
+func (uid *UinputDevice) setup(info *events.DeviceAttached) error {
+	for typ, codes := range info.Capabilities {
+		if err := ioctl(uid.file, uiSetEvBit, uintptr(typ)); err != nil {
+			return fmt.Errorf("failed to set event type %d: %w", typ, err)
+		}
+
+		var request uintptr
+		switch typ {
+		case evdev.EV_KEY:
+			request = uiSetKeyBit
+		case evdev.EV_REL:
+			request = uiSetRelBit
+		case evdev.EV_ABS:
+			request = uiSetAbsBit
+		case evdev.EV_MSC:
+			request = uiSetMscBit
+		default:
+			continue
+		}
+
+		for _, code := range codes {
+			if err := ioctl(uid.file, request, uintptr(code)); err != nil {
+				return fmt.Errorf("failed to set event code %d:%d: %w", typ, code, err)
+			}
+		}
+	}
+
+	for code, absInfo := range info.AbsInfo {
+		absSetup := uinputAbsSetup{
+			Code:    code,
+			AbsInfo: absInfo,
+		}
+
+		if err := ioctl(uid.file, uiAbsSetup, uintptr(unsafe.Pointer(&absSetup))); err != nil {
+			return fmt.Errorf("failed to setup abs axis %d: %w", code, err)
+		}
+	}
+
+	setup := uinputSetup{
+		BusType: info.BusType,
+		Vendor:  info.Vendor,
+		Product: info.Product,
+		Version: info.Version,
+	}
+	copy(setup.Name[:len(setup.Name)-1], info.Name)
+
+	if err := ioctl(uid.file, uiDevSetup, uintptr(unsafe.Pointer(&setup))); err != nil {
+		return fmt.Errorf("failed to setup device: %w", err)
+	}
+
+	if err := ioctl(uid.file, uiDevCreate, 0); err != nil {
+		return fmt.Errorf("failed to create device: %w", err)
+	}
+
+	return nil
+}
+
+func ioctl(file *os.File, request, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, arg)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -12,4 +12,6 @@ type Vdu interface {
 	DisplayBounds() ([]screens.DisplayBounds, error)
 	HideCursor() error
 	ShowCursor() error
+	// KeyMap for the currently active keyboard layout
+	KeyMap() (KeyMap, error)
 }
@@ -97,4 +97,79 @@ func (x11 X11Vdu) ShowCursor() error {
 		Check()
 }
 
+// KeyMap builds a character map from the keyboard mapping currently loaded into the x server
+func (x11 X11Vdu) KeyMap() (KeyMap, error) {
+	setup := xproto.Setup(x11.xcon)
+	if setup == nil {
+		return nil, errors.New("failed to setup xproto")
+	}
+
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+	mapping, err := xproto.GetKeyboardMapping(x11.xcon, setup.MinKeycode, count).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keyboard mapping: %w", err)
+	}
+
+	// x keysym columns for: plain, shift, (group 2 plain, group 2 shift), altgr, altgr+shift
+	levels := []struct {
+		column int
+		shift  bool
+		altGr  bool
+	}{
+		{0, false, false},
+		{1, true, false},
+		{4, false, true},
+		{5, true, true},
+	}
+
+	var (
+		keymap = make(KeyMap)
+		width  = int(mapping.KeysymsPerKeycode)
+	)
+
+	for _, level := range levels {
+		if level.column >= width {
+			continue
+		}
+
+		for i := 0; i < int(count); i++ {
+			char := keysymToRune(mapping.Keysyms[i*width+level.column])
+			if char == 0 {
+				continue
+			}
+
+			if _, ok := keymap[char]; ok {
+				continue
+			}
+
+			keymap[char] = KeyStroke{
+				// x keycodes are offset by 8 from their evdev counterparts
+				Code:  uint16(int(setup.MinKeycode)+i) - 8,
+				Shift: level.shift,
+				AltGr: level.altGr,
+			}
+		}
+	}
+
+	return keymap, nil
+}
+
+// keysymToRune converts an x keysym to the unicode character it represents
+// keysyms that do not map to a printable character will return 0
+func keysymToRune(sym xproto.Keysym) rune {
+	switch {
+	case sym >= 0x20 && sym <= 0x7e, sym >= 0xa0 && sym <= 0xff:
+		// latin 1 keysyms map directly to their unicode code points
+		return rune(sym)
+	case sym&0xff000000 == 0x01000000:
+		return rune(sym & 0x00ffffff)
+	case sym == 0xff0d:
+		return '\n'
+	case sym == 0xff09:
+		return '\t'
+	}
+
+	return 0
+}
+
 var _ Vdu = (*X11Vdu)(nil)
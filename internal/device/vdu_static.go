@@ -0,0 +1,65 @@
+package device
+
+import (
+	"errors"
+
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/screens"
+)
+
+var _ Vdu = (*StaticVdu)(nil)
+
+// StaticVdu reports display bounds from config for peers without a window server that can be queried
+// the cursor position is unknown so the peer can never trigger its own transition zones
+type StaticVdu struct {
+	displays []screens.DisplayBounds
+}
+
+// NewStaticVdu creates a vdu from the configured displays
+func NewStaticVdu(displays []config.StaticDisplay) (*StaticVdu, error) {
+	if len(displays) == 0 {
+		return nil, errors.New("no static displays configured")
+	}
+
+	vdu := &StaticVdu{}
+	for _, display := range displays {
+		vdu.displays = append(vdu.displays, screens.DisplayBounds{
+			Position: common.Vector2{X: display.X, Y: display.Y},
+			Width:    display.Width,
+			Height:   display.Height,
+		})
+	}
+
+	return vdu, nil
+}
+
+// Close is a noop for static displays
+func (vdu *StaticVdu) Close() error {
+	return nil
+}
+
+// CursorPos is not available without a window server
+func (vdu *StaticVdu) CursorPos() (*common.Vector2, error) {
+	return nil, errors.New("cursor position not available for static displays")
+}
+
+// DisplayBounds as configured
+func (vdu *StaticVdu) DisplayBounds() ([]screens.DisplayBounds, error) {
+	return append([]screens.DisplayBounds(nil), vdu.displays...), nil
+}
+
+// HideCursor is a noop for static displays
+func (vdu *StaticVdu) HideCursor() error {
+	return nil
+}
+
+// ShowCursor is a noop for static displays
+func (vdu *StaticVdu) ShowCursor() error {
+	return nil
+}
+
+// KeyMap cant be queried without a window server so a us layout is assumed
+func (vdu *StaticVdu) KeyMap() (KeyMap, error) {
+	return DefaultKeyMap(), nil
+}
@@ -0,0 +1,55 @@
+package events
+
+// AuthChallenge is sent by the server as soon as a peer connects
+// the peer must prove that it knows the cluster secret before it is allowed to join
+type AuthChallenge struct {
+	Nonce []byte `msgpack:"n"`
+}
+
+// Marshal AuthChallenge struct into a byte array for sending via websocket
+func (ev *AuthChallenge) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeAuthChallenge)
+}
+
+// String gives the string name of the event type
+func (ev *AuthChallenge) String() string {
+	return "AuthChallenge"
+}
+
+var _ WsMessage = (*AuthChallenge)(nil)
+
+// AuthResponse is the peers answer to the challenge
+// it includes a challenge of its own so that the peer can also verify the server
+type AuthResponse struct {
+	Nonce []byte `msgpack:"n"`
+	Proof []byte `msgpack:"p"`
+}
+
+// Marshal AuthResponse struct into a byte array for sending via websocket
+func (ev *AuthResponse) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeAuthResponse)
+}
+
+// String gives the string name of the event type
+func (ev *AuthResponse) String() string {
+	return "AuthResponse"
+}
+
+var _ WsMessage = (*AuthResponse)(nil)
+
+// AuthResult is sent by the server once the peer has been accepted
+type AuthResult struct {
+	Proof []byte `msgpack:"p"`
+}
+
+// Marshal AuthResult struct into a byte array for sending via websocket
+func (ev *AuthResult) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeAuthResult)
+}
+
+// String gives the string name of the event type
+func (ev *AuthResult) String() string {
+	return "AuthResult"
+}
+
+var _ WsMessage = (*AuthResult)(nil)
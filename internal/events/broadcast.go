@@ -0,0 +1,43 @@
+package events
+
+import "github.com/google/uuid"
+
+// ToggleBroadcast is sent by a peer to start or stop broadcasting its keyboard input to the
+// configured set of peers
+type ToggleBroadcast struct {
+}
+
+// Marshal ToggleBroadcast struct into a byte array for sending via websocket
+func (ev *ToggleBroadcast) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeToggleBroadcast)
+}
+
+// String gives the string name of the event type
+func (ev *ToggleBroadcast) String() string {
+	return "ToggleBroadcast"
+}
+
+var _ WsMessage = (*ToggleBroadcast)(nil)
+
+// BroadcastState is sent to all peers whenever broadcast input is started or stopped
+type BroadcastState struct {
+	Active bool `json:"active" msgpack:"a"`
+	// Source peer whose keyboard is being broadcast
+	Source uuid.UUID `json:"source" msgpack:"s"`
+	// Peers hostnames that are recieving the keyboard input
+	Peers []string `json:"peers" msgpack:"p"`
+	// Until is the unix time that broadcasting will automatically stop
+	Until int64 `json:"until" msgpack:"u"`
+}
+
+// Marshal BroadcastState struct into a byte array for sending via websocket
+func (ev *BroadcastState) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeBroadcastState)
+}
+
+// String gives the string name of the event type
+func (ev *BroadcastState) String() string {
+	return "BroadcastState"
+}
+
+var _ WsMessage = (*BroadcastState)(nil)
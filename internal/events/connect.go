@@ -10,6 +10,14 @@ type ClientConnect struct {
 	Hostname string    `msgpack:"h"`
 	UUID     uuid.UUID `msgpack:"u"`
 	Displays []screens.DisplayBounds
+	// Udp is set if the peer can use a udp data channel for input
+	Udp bool `msgpack:"udp,omitempty"`
+	// DirectPort the peer accepts direct input from other peers on, zero if it doesnt
+	DirectPort uint16 `msgpack:"dp,omitempty"`
+	// PublicKey of the peers identity and its Signature over the servers auth challenge
+	// the server only trusts the uuid if the key matches the one pinned when the peer was approved
+	PublicKey []byte `msgpack:"pk"`
+	Signature []byte `msgpack:"sig"`
 }
 
 // Marshal ClientConnect struct into a byte array for sending via websocket
@@ -23,3 +31,22 @@ func (ev *ClientConnect) String() string {
 }
 
 var _ WsMessage = (*ClientConnect)(nil)
+
+// SessionResumed is sent to a peer that reconnected before its place in the cluster was given up
+// it carries the focus the peer had so that it can pick up where it left off, nil means local
+type SessionResumed struct {
+	Pointer  uuid.UUID `msgpack:"p"`
+	Keyboard uuid.UUID `msgpack:"k"`
+}
+
+// Marshal SessionResumed struct into a byte array for sending via websocket
+func (ev *SessionResumed) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeSessionResumed)
+}
+
+// String gives the string name of the event type
+func (ev *SessionResumed) String() string {
+	return "SessionResumed"
+}
+
+var _ WsMessage = (*SessionResumed)(nil)
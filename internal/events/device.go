@@ -0,0 +1,98 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/common"
+)
+
+type DeviceClass uint8
+
+const (
+	DeviceClassGamepad DeviceClass = iota
+	DeviceClassTouchpad
+	DeviceClassTablet
+)
+
+// AbsInfo describes the range and resolution of an absolute axis
+type AbsInfo struct {
+	Value      int32 `msgpack:"v"`
+	Minimum    int32 `msgpack:"n"`
+	Maximum    int32 `msgpack:"x"`
+	Fuzz       int32 `msgpack:"f"`
+	Flat       int32 `msgpack:"l"`
+	Resolution int32 `msgpack:"r"`
+}
+
+// DeviceAttached is sent by a peer that has a local device which is to be mirrored on another peer
+// it contains everything needed to create a matching virtual device on the target
+type DeviceAttached struct {
+	// ID of the device on its source peer
+	ID string `msgpack:"i"`
+	// Source peer of the device, this is filled in by the server before forwarding
+	Source uuid.UUID `msgpack:"s"`
+	// Target hostname for devices that are assigned to a specific peer
+	// if left empty the device will follow focus
+	Target  string      `msgpack:"t"`
+	Name    string      `msgpack:"n"`
+	Class   DeviceClass `msgpack:"c"`
+	BusType uint16      `msgpack:"b"`
+	Vendor  uint16      `msgpack:"vd"`
+	Product uint16      `msgpack:"p"`
+	Version uint16      `msgpack:"vr"`
+	// Capabilities of the device, event codes keyed by event type
+	Capabilities map[uint16][]uint16 `msgpack:"e"`
+	// AbsInfo for each of the devices absolute axes
+	AbsInfo map[uint16]AbsInfo `msgpack:"a"`
+	// Area of the target peers desktop that absolute pointer axes are mapped onto
+	// this is filled in by the server from the screen layout
+	Area common.Vector4 `msgpack:"r"`
+}
+
+// Marshal DeviceAttached struct into a byte array for sending via websocket
+func (ev *DeviceAttached) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDeviceAttached)
+}
+
+// String gives the string name of the event type
+func (ev *DeviceAttached) String() string {
+	return "DeviceAttached"
+}
+
+var _ WsMessage = (*DeviceAttached)(nil)
+
+// DeviceDetached is sent when a mirrored device is no longer available on its source peer
+type DeviceDetached struct {
+	ID     string    `msgpack:"i"`
+	Source uuid.UUID `msgpack:"s"`
+}
+
+// Marshal DeviceDetached struct into a byte array for sending via websocket
+func (ev *DeviceDetached) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDeviceDetached)
+}
+
+// String gives the string name of the event type
+func (ev *DeviceDetached) String() string {
+	return "DeviceDetached"
+}
+
+var _ WsMessage = (*DeviceDetached)(nil)
+
+// DeviceInput carries all the events for a mirrored device up to and including the SYN_REPORT
+type DeviceInput struct {
+	ID     string       `msgpack:"i"`
+	Source uuid.UUID    `msgpack:"s"`
+	Events []InputEvent `msgpack:"e"`
+}
+
+// Marshal DeviceInput struct into a byte array for sending via websocket
+func (ev *DeviceInput) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDeviceInput)
+}
+
+// String gives the string name of the event type
+func (ev *DeviceInput) String() string {
+	return "DeviceInput"
+}
+
+var _ WsMessage = (*DeviceInput)(nil)
@@ -0,0 +1,65 @@
+package events
+
+import "github.com/google/uuid"
+
+// DirectRoute is sent to a source peer to tell it where to send its input
+// the source opens a direct channel to the target with the session and sends its frames over it
+// rather than through the server, a nil Target sends them back through the server
+type DirectRoute struct {
+	Target  uuid.UUID `msgpack:"t"`
+	Address string    `msgpack:"a"`
+	Port    uint16    `msgpack:"p"`
+	Session uint32    `msgpack:"s"`
+	Key     []byte    `msgpack:"k"`
+}
+
+// Marshal DirectRoute struct into a byte array for sending via websocket
+func (ev *DirectRoute) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDirectRoute)
+}
+
+// String gives the string name of the event type
+func (ev *DirectRoute) String() string {
+	return "DirectRoute"
+}
+
+var _ WsMessage = (*DirectRoute)(nil)
+
+// DirectAccept is sent to a target peer so that it will accept a direct channel from the source
+// the session is only valid for a short time if the source never opens it
+type DirectAccept struct {
+	Source  uuid.UUID `msgpack:"u"`
+	Session uint32    `msgpack:"s"`
+	Key     []byte    `msgpack:"k"`
+}
+
+// Marshal DirectAccept struct into a byte array for sending via websocket
+func (ev *DirectAccept) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDirectAccept)
+}
+
+// String gives the string name of the event type
+func (ev *DirectAccept) String() string {
+	return "DirectAccept"
+}
+
+var _ WsMessage = (*DirectAccept)(nil)
+
+// DirectRevoke closes a direct channel
+// the server sends it to both ends when the session is no longer valid, a source sends it to the
+// server when it could not reach the target
+type DirectRevoke struct {
+	Session uint32 `msgpack:"s"`
+}
+
+// Marshal DirectRevoke struct into a byte array for sending via websocket
+func (ev *DirectRevoke) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeDirectRevoke)
+}
+
+// String gives the string name of the event type
+func (ev *DirectRevoke) String() string {
+	return "DirectRevoke"
+}
+
+var _ WsMessage = (*DirectRevoke)(nil)
@@ -11,6 +11,27 @@ const (
 	MsgTypeReleaseFouces
 	MsgTypeInputEvent
 	MsgTypeTrasitionAssigned
+	MsgTypeTypeText
+	MsgTypeDeviceAttached
+	MsgTypeDeviceDetached
+	MsgTypeDeviceInput
+	MsgTypeInputFrame
+	MsgTypeMacroRecorded
+	MsgTypeMacrosUpdated
+	MsgTypePlayMacro
+	MsgTypeMacroPlayback
+	MsgTypeMoveKeyboardFocus
+	MsgTypeKeyboardFocusChanged
+	MsgTypeToggleBroadcast
+	MsgTypeBroadcastState
+	MsgTypeAuthChallenge
+	MsgTypeAuthResponse
+	MsgTypeAuthResult
+	MsgTypeUdpOffer
+	MsgTypeDirectRoute
+	MsgTypeDirectAccept
+	MsgTypeDirectRevoke
+	MsgTypeSessionResumed
 )
 
 // WsMessage interface describes any message/event that is transmissable
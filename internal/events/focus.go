@@ -7,8 +7,9 @@ import (
 
 // ChangeFocus from the active client to a peer
 type ChangeFocus struct {
-	UUID uuid.UUID `msgpack:"u"`
-	Pos  common.Vector2   `msgpack:"p"`
+	UUID   uuid.UUID      `msgpack:"u"`
+	Pos    common.Vector2 `msgpack:"p"`
+	Repeat KeyRepeat      `msgpack:"r"`
 }
 
 // Marshal ChangeFocus struct into a byte array for sending via websocket
@@ -23,12 +24,23 @@ func (ev *ChangeFocus) String() string {
 
 var _ WsMessage = (*ChangeFocus)(nil)
 
+// KeyRepeat describes how held keys should be repeated on the peer recieving focus
+type KeyRepeat struct {
+	// Target has the recieving peer repeat held keys itself using the given delay and period
+	// otherwise the repeats are sent by the source and the recieving peers own repeat is disabled
+	Target   bool  `msgpack:"t"`
+	DelayMs  int32 `msgpack:"d"`
+	PeriodMs int32 `msgpack:"p"`
+}
+
 // FocusRecieved from a peer
 // this message will be sent to the active client to inform them they now have focus
 type FocusRecieved struct {
 	// ID of the transition zone that triggerd the focus
 	ID  uuid.UUID
 	Pos uint `msgpack:"x"`
+	// Repeat settings of the peer giving focus
+	Repeat KeyRepeat `msgpack:"r"`
 }
 
 // Marshal FocusRecieved struct into a byte array for sending via websocket
@@ -60,3 +72,38 @@ func (ev *ReleaseFocus) String() string {
 }
 
 var _ WsMessage = (*ReleaseFocus)(nil)
+
+// MoveKeyboardFocus on its own leaving pointer focus where it is
+type MoveKeyboardFocus struct {
+	// Reset returns keyboard focus to the peer with pointer focus rather than moving it to the next peer
+	Reset bool `msgpack:"r"`
+}
+
+// Marshal MoveKeyboardFocus struct into a byte array for sending via websocket
+func (ev *MoveKeyboardFocus) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeMoveKeyboardFocus)
+}
+
+// String gives the string name of the event type
+func (ev *MoveKeyboardFocus) String() string {
+	return "MoveKeyboardFocus"
+}
+
+var _ WsMessage = (*MoveKeyboardFocus)(nil)
+
+// KeyboardFocusChanged is sent to the peer that moved keyboard focus to let it know where it ended up
+type KeyboardFocusChanged struct {
+	UUID uuid.UUID `msgpack:"u"`
+}
+
+// Marshal KeyboardFocusChanged struct into a byte array for sending via websocket
+func (ev *KeyboardFocusChanged) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeKeyboardFocusChanged)
+}
+
+// String gives the string name of the event type
+func (ev *KeyboardFocusChanged) String() string {
+	return "KeyboardFocusChanged"
+}
+
+var _ WsMessage = (*KeyboardFocusChanged)(nil)
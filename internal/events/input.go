@@ -24,3 +24,100 @@ func (ev *InputEvent) String() string {
 }
 
 var _ WsMessage = (*InputEvent)(nil)
+
+// linux event types/codes needed to inspect frames without depending on the device package
+const (
+	evSyn     = 0x00
+	evKey     = 0x01
+	evRel     = 0x02
+	synReport = 0x00
+	relX      = 0x00
+	relY      = 0x01
+)
+
+// InputFrame groups all the events from a device up to and including the SYN_REPORT that ends them
+// frames are applied atomically on the recieving peer
+type InputFrame struct {
+	Events []InputEvent `msgpack:"e"`
+	// Target hostname of the peer the frame is pinned to, empty frames go to the focused peer
+	Target string `msgpack:"t,omitempty"`
+}
+
+// Marshal InputFrame struct into a byte array for sending via websocket
+func (ev *InputFrame) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeInputFrame)
+}
+
+// String gives the string name of the event type
+func (ev *InputFrame) String() string {
+	return "InputFrame"
+}
+
+// IsMotion reports if the frame contains nothing but relative pointer motion
+func (ev *InputFrame) IsMotion() bool {
+	if len(ev.Events) == 0 {
+		return false
+	}
+
+	for _, event := range ev.Events {
+		switch {
+		case event.Type == evRel && (event.Code == relX || event.Code == relY):
+		case event.Type == evSyn && event.Code == synReport:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// TrackHeld updates the set of held keys and buttons with the presses and releases in the frame
+func (ev *InputFrame) TrackHeld(held map[uint16]bool) {
+	for _, event := range ev.Events {
+		if event.Type != evKey {
+			continue
+		}
+
+		switch event.Value {
+		case 0:
+			delete(held, event.Code)
+		case 1:
+			held[event.Code] = true
+		}
+	}
+}
+
+// Merge two motion frames into a single frame that moves the pointer by their combined distance
+func (ev *InputFrame) Merge(next *InputFrame) *InputFrame {
+	var (
+		x, y   int32
+		evTime = next.Events[len(next.Events)-1].Time
+	)
+
+	for _, frame := range []*InputFrame{ev, next} {
+		for _, event := range frame.Events {
+			if event.Type != evRel {
+				continue
+			}
+
+			if event.Code == relX {
+				x += event.Value
+			} else {
+				y += event.Value
+			}
+		}
+	}
+
+	merged := &InputFrame{Target: ev.Target}
+	if x != 0 {
+		merged.Events = append(merged.Events, InputEvent{Time: evTime, Type: evRel, Code: relX, Value: x})
+	}
+	if y != 0 {
+		merged.Events = append(merged.Events, InputEvent{Time: evTime, Type: evRel, Code: relY, Value: y})
+	}
+	merged.Events = append(merged.Events, InputEvent{Time: evTime, Type: evSyn, Code: synReport})
+
+	return merged
+}
+
+var _ WsMessage = (*InputFrame)(nil)
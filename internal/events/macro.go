@@ -0,0 +1,86 @@
+package events
+
+// MacroStep is a single frame of input in a macro
+type MacroStep struct {
+	// DelayMs since the previous step
+	DelayMs int64      `json:"delay_ms" msgpack:"d"`
+	Frame   InputFrame `json:"frame" msgpack:"f"`
+}
+
+// Macro is a recorded sequence of input that can be played back on any peer
+type Macro struct {
+	Name string `json:"name" msgpack:"n"`
+	// Chord of key codes that will trigger the macro
+	Chord []uint16 `json:"chord" msgpack:"c"`
+	// Target hostname of the peer the macro is played on, if empty it will play on the focused peer
+	Target string      `json:"target" msgpack:"t"`
+	Steps  []MacroStep `json:"steps" msgpack:"s"`
+}
+
+// MacroRecorded is sent from a peer once it has finished recording a new macro
+type MacroRecorded struct {
+	Steps []MacroStep `msgpack:"s"`
+}
+
+// Marshal MacroRecorded struct into a byte array for sending via websocket
+func (ev *MacroRecorded) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeMacroRecorded)
+}
+
+// String gives the string name of the event type
+func (ev *MacroRecorded) String() string {
+	return "MacroRecorded"
+}
+
+var _ WsMessage = (*MacroRecorded)(nil)
+
+// MacrosUpdated is sent to all peers when the cluster macros change
+// the steps are left out, they are only sent to the target when the macro is played
+type MacrosUpdated []Macro
+
+// Marshal MacrosUpdated struct into a byte array for sending via websocket
+func (ev MacrosUpdated) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeMacrosUpdated)
+}
+
+// String gives the string name of the event type
+func (ev MacrosUpdated) String() string {
+	return "MacrosUpdated"
+}
+
+var _ WsMessage = (MacrosUpdated)(nil)
+
+// PlayMacro is sent by a peer when the chord for a macro has been pressed
+type PlayMacro struct {
+	Name string `msgpack:"n"`
+}
+
+// Marshal PlayMacro struct into a byte array for sending via websocket
+func (ev *PlayMacro) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypePlayMacro)
+}
+
+// String gives the string name of the event type
+func (ev *PlayMacro) String() string {
+	return "PlayMacro"
+}
+
+var _ WsMessage = (*PlayMacro)(nil)
+
+// MacroPlayback is sent to the peer that a macro should be played on
+type MacroPlayback struct {
+	Name  string      `msgpack:"n"`
+	Steps []MacroStep `msgpack:"s"`
+}
+
+// Marshal MacroPlayback struct into a byte array for sending via websocket
+func (ev *MacroPlayback) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeMacroPlayback)
+}
+
+// String gives the string name of the event type
+func (ev *MacroPlayback) String() string {
+	return "MacroPlayback"
+}
+
+var _ WsMessage = (*MacroPlayback)(nil)
@@ -0,0 +1,20 @@
+package events
+
+// TypeText asks the recieving peer to type out the given text using its local keyboard layout
+type TypeText struct {
+	Text string `msgpack:"t"`
+	// DelayMs between key strokes, if left at 0 the recieving peer will use its configured delay
+	DelayMs uint16 `msgpack:"d"`
+}
+
+// Marshal TypeText struct into a byte array for sending via websocket
+func (ev *TypeText) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeTypeText)
+}
+
+// String gives the string name of the event type
+func (ev *TypeText) String() string {
+	return "TypeText"
+}
+
+var _ WsMessage = (*TypeText)(nil)
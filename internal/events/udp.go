@@ -0,0 +1,21 @@
+package events
+
+// UdpOffer is sent by the server to a peer that supports the udp data channel
+// the peer uses it to open the channel, all packets are sealed with the session key
+type UdpOffer struct {
+	Session uint32 `msgpack:"s"`
+	Key     []byte `msgpack:"k"`
+	Port    uint16 `msgpack:"p"`
+}
+
+// Marshal UdpOffer struct into a byte array for sending via websocket
+func (ev *UdpOffer) Marshal() ([]byte, error) {
+	return marshalEvent(ev, MsgTypeUdpOffer)
+}
+
+// String gives the string name of the event type
+func (ev *UdpOffer) String() string {
+	return "UdpOffer"
+}
+
+var _ WsMessage = (*UdpOffer)(nil)
@@ -0,0 +1,378 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var errHelperClosed = errors.New("connection to input helper lost")
+
+// most device events held for the app before new ones are dropped
+const maxQueuedEvents = 1024
+
+// Client is the unprivileged side of the helper
+// it stands in for the DeviceManager in the main process, passing everything through to the helper
+type Client struct {
+	device.Streams
+
+	ctx *common.Context
+	con *net.UnixConn
+	// calls waiting on a result from the helper
+	calls    map[uint32]chan *message
+	nextID   uint32
+	closed   bool
+	mux      sync.Mutex
+	writeMux sync.Mutex
+
+	// device events waiting to be handed to the app
+	// they are queued so that call results are never held up behind an app that is busy making a call
+	queue      []queuedEvent
+	queueReady chan struct{}
+	queueMux   sync.Mutex
+	// set while events are being dropped so the overflow is only logged once
+	dropping bool
+}
+
+// queuedEvent from the helper, only one of the fields is set
+type queuedEvent struct {
+	frame    *events.InputFrame
+	mirrored events.WsMessage
+}
+
+var _ device.Manager = (*Client)(nil)
+
+// Dial the helper on the configured socket
+func Dial(ctx *common.Context) (*Client, error) {
+	con, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: ctx.Config.Helper.Socket, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to input helper: %w", err)
+	}
+
+	client := &Client{
+		Streams: device.NewStreams(),
+		ctx:     ctx,
+		con:     con,
+		calls:   make(map[uint32]chan *message),
+
+		queueReady: make(chan struct{}, 1),
+	}
+
+	go client.readFromHelper()
+	go client.forwardEvents()
+	go client.consumeIncommingEvents()
+
+	return client, nil
+}
+
+// GrabAccess exclusive access to all the devices being watched by the helper
+func (cl *Client) GrabAccess() error {
+	return cl.call(callGrabAccess, nil, nil)
+}
+
+// GrabKeyboards grabs exclusive access to the keyboards being watched by the helper
+func (cl *Client) GrabKeyboards() error {
+	return cl.call(callGrabKeyboards, nil, nil)
+}
+
+// ReleaseAccess exclusive access from all the devices being watched by the helper
+func (cl *Client) ReleaseAccess() error {
+	return cl.call(callReleaseAccess, nil, nil)
+}
+
+// Close the connection to the helper, the helper releases the devices when it sees it go
+func (cl *Client) Close() error {
+	return cl.con.Close()
+}
+
+// MirroredDevices gives the details of all the helpers devices that are to be mirrored on other peers
+func (cl *Client) MirroredDevices() []*events.DeviceAttached {
+	var devices []*events.DeviceAttached
+	if err := cl.call(callMirroredDevices, nil, &devices); err != nil {
+		Logf("helper", "mirrored devices: %s", err)
+	}
+
+	return devices
+}
+
+// AttachMirror creates a virtual device in the helper to mirror a device on another peer
+func (cl *Client) AttachMirror(info *events.DeviceAttached) error {
+	return cl.call(callAttachMirror, info, nil)
+}
+
+// DetachMirror removes a mirror device from the helper
+func (cl *Client) DetachMirror(source uuid.UUID, id string) error {
+	return cl.call(callDetachMirror, &detachArgs{Source: source, ID: id}, nil)
+}
+
+// MoveCursor relative to its current position
+func (cl *Client) MoveCursor(delta common.Vector2) {
+	if err := cl.call(callMoveCursor, delta, nil); err != nil {
+		Logf("helper", "move cursor: %s", err)
+	}
+}
+
+// KeyRepeat gives the key repeat settings that a peer recieving focus should use
+func (cl *Client) KeyRepeat() events.KeyRepeat {
+	var repeat events.KeyRepeat
+	if err := cl.call(callKeyRepeat, nil, &repeat); err != nil {
+		Logf("helper", "key repeat: %s", err)
+	}
+
+	return repeat
+}
+
+// SetKeyRepeat updates the soft repeat on the helpers virtual device
+func (cl *Client) SetKeyRepeat(repeat events.KeyRepeat) {
+	if err := cl.call(callSetKeyRepeat, repeat, nil); err != nil {
+		Logf("helper", "set key repeat: %s", err)
+	}
+}
+
+// TypeText on the helpers virtual device
+func (cl *Client) TypeText(text string, keymap device.KeyMap, delay time.Duration, fallback bool) {
+	args := typeTextArgs{
+		Text:     text,
+		KeyMap:   keymap,
+		DelayMs:  delay.Milliseconds(),
+		Fallback: fallback,
+	}
+
+	if err := cl.call(callTypeText, &args, nil); err != nil {
+		Logf("helper", "type text: %s", err)
+	}
+}
+
+// call a device operation in the helper and wait for its result
+func (cl *Client) call(name string, args, reply any) error {
+	msg, err := newMessage(opCall, args)
+	if err != nil {
+		return err
+	}
+
+	result := make(chan *message, 1)
+
+	cl.mux.Lock()
+	if cl.closed {
+		cl.mux.Unlock()
+		return errHelperClosed
+	}
+
+	cl.nextID++
+	msg.ID = cl.nextID
+	msg.Call = name
+	cl.calls[msg.ID] = result
+	cl.mux.Unlock()
+
+	if err := cl.send(msg); err != nil {
+		cl.mux.Lock()
+		delete(cl.calls, msg.ID)
+		cl.mux.Unlock()
+
+		return err
+	}
+
+	res, ok := <-result
+	if !ok {
+		return errHelperClosed
+	}
+
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+
+	if reply != nil && len(res.Data) > 0 {
+		return msgpack.Unmarshal(res.Data, reply)
+	}
+
+	return nil
+}
+
+// readFromHelper and queue the device events for the app
+// this never blocks on the app as it is also what delivers the results of the apps calls
+// losing the helper leaves the app with no input devices so the app is shut down
+func (cl *Client) readFromHelper() {
+	defer func() {
+		cl.mux.Lock()
+		cl.closed = true
+		for id, result := range cl.calls {
+			close(result)
+			delete(cl.calls, id)
+		}
+		cl.mux.Unlock()
+
+		Log("helper", errHelperClosed.Error())
+		cl.ctx.Cancel()
+	}()
+
+	reader := bufio.NewReader(cl.con)
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+
+		switch msg.Op {
+		case opFrame:
+			var frame events.InputFrame
+			if err := msgpack.Unmarshal(msg.Data, &frame); err == nil {
+				cl.enqueue(queuedEvent{frame: &frame})
+			}
+
+		case opMirrored:
+			if mirrored := unmarshalMirrored(msg.Data); mirrored != nil {
+				cl.enqueue(queuedEvent{mirrored: mirrored})
+			}
+
+		case opResult:
+			cl.mux.Lock()
+			result, ok := cl.calls[msg.ID]
+			delete(cl.calls, msg.ID)
+			cl.mux.Unlock()
+
+			if ok {
+				result <- msg
+			}
+		}
+	}
+}
+
+// enqueue a device event for the app
+// motion is merged into a motion frame already waiting at the back of the queue and once the queue
+// is full new events are dropped rather than letting it grow without bound
+func (cl *Client) enqueue(ev queuedEvent) {
+	cl.queueMux.Lock()
+
+	if n := len(cl.queue); n > 0 && ev.frame != nil && ev.frame.IsMotion() {
+		last := cl.queue[n-1].frame
+		if last != nil && last.IsMotion() && last.Target == ev.frame.Target {
+			cl.queue[n-1].frame = last.Merge(ev.frame)
+			cl.queueMux.Unlock()
+			return
+		}
+	}
+
+	switch {
+	case len(cl.queue) < maxQueuedEvents:
+		cl.queue = append(cl.queue, ev)
+		cl.dropping = false
+	case !cl.dropping:
+		Log("helper", "app is not keeping up, dropping device events")
+		cl.dropping = true
+	}
+
+	cl.queueMux.Unlock()
+
+	select {
+	case cl.queueReady <- struct{}{}:
+	default:
+	}
+}
+
+// forwardEvents from the queue to the app in the order they came from the helper
+func (cl *Client) forwardEvents() {
+	for {
+		select {
+		case <-cl.ctx.Done():
+			return
+		case <-cl.queueReady:
+		}
+
+		for {
+			cl.queueMux.Lock()
+			if len(cl.queue) == 0 {
+				cl.queueMux.Unlock()
+				break
+			}
+
+			ev := cl.queue[0]
+			cl.queue[0] = queuedEvent{}
+			cl.queue = cl.queue[1:]
+			cl.queueMux.Unlock()
+
+			if ev.frame != nil {
+				select {
+				case cl.Events <- ev.frame:
+				case <-cl.ctx.Done():
+					return
+				}
+
+				continue
+			}
+
+			select {
+			case cl.Mirrored <- ev.mirrored:
+			case <-cl.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// consumeIncommingEvents from the app and pass them on to the helper
+func (cl *Client) consumeIncommingEvents() {
+	for {
+		var (
+			msg *message
+			err error
+		)
+
+		select {
+		case <-cl.ctx.Done():
+			return
+
+		case frame := <-cl.Input:
+			msg, err = newMessage(opFrame, frame)
+
+		case input := <-cl.MirrorInput:
+			msg, err = newMessage(opMirrorInput, input)
+		}
+
+		if err == nil {
+			err = cl.send(msg)
+		}
+
+		if err != nil {
+			Logf("helper", "failed to send input: %s", err)
+		}
+	}
+}
+
+// send a message to the helper
+func (cl *Client) send(msg *message) error {
+	cl.writeMux.Lock()
+	defer cl.writeMux.Unlock()
+
+	return writeMessage(cl.con, msg)
+}
+
+// unmarshalMirrored turns a websocket message from a mirrored device back into its event
+func unmarshalMirrored(data []byte) events.WsMessage {
+	if len(data) < 2 {
+		return nil
+	}
+
+	switch events.MsgType(data[0]) {
+	case events.MsgTypeDeviceInput:
+		if input := events.Unmarshal[events.DeviceInput](data[2:]); input != nil {
+			return input
+		}
+
+	case events.MsgTypeDeviceDetached:
+		if detached := events.Unmarshal[events.DeviceDetached](data[2:]); detached != nil {
+			return detached
+		}
+	}
+
+	return nil
+}
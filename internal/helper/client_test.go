@@ -0,0 +1,161 @@
+package helper
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// fakeHelper streams the input frame as fast as it can and answers every call
+func fakeHelper(t *testing.T, listener *net.UnixListener, frame *events.InputFrame) {
+	con, err := listener.AcceptUnix()
+	if err != nil {
+		return
+	}
+	defer con.Close()
+
+	var writeMux sync.Mutex
+	write := func(msg *message) error {
+		writeMux.Lock()
+		defer writeMux.Unlock()
+
+		return writeMessage(con, msg)
+	}
+
+	go func() {
+		for {
+			msg, err := newMessage(opFrame, frame)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if write(msg) != nil {
+				return
+			}
+		}
+	}()
+
+	reader := bufio.NewReader(con)
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+
+		if msg.Op == opCall {
+			if write(&message{Op: opResult, ID: msg.ID}) != nil {
+				return
+			}
+		}
+	}
+}
+
+// dialFakeHelper starts a fake helper streaming the frame and connects a client to it
+func dialFakeHelper(t *testing.T, frame *events.InputFrame) *Client {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "helper.sock")
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go fakeHelper(t, listener, frame)
+
+	conf := &config.Config{}
+	conf.Helper.Socket = path
+	ctx := common.NewContext(conf)
+	t.Cleanup(ctx.Cancel)
+
+	client, err := Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// waitForQueue until the condition holds for the clients event queue
+func waitForQueue(t *testing.T, client *Client, cond func([]queuedEvent) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		client.queueMux.Lock()
+		ok := cond(client.queue)
+		client.queueMux.Unlock()
+
+		if ok {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("timed out waiting on the event queue")
+}
+
+func TestCallCompletesWhileFramesBackUp(t *testing.T) {
+	client := dialFakeHelper(t, &events.InputFrame{Events: []events.InputEvent{{Type: 1, Code: 30, Value: 1}}})
+
+	// nothing reads the events, just like the app while it is busy making a call
+	// the queue fills up to its cap before the call goes out
+	waitForQueue(t, client, func(queue []queuedEvent) bool {
+		return len(queue) == maxQueuedEvents
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.ReleaseAccess()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call blocked behind undelivered frames")
+	}
+
+	client.queueMux.Lock()
+	queued := len(client.queue)
+	client.queueMux.Unlock()
+
+	if queued > maxQueuedEvents {
+		t.Fatalf("queue grew past its cap to %d", queued)
+	}
+
+	// the frames queued during the call still reach the app in order
+	select {
+	case frame := <-client.Events:
+		if len(frame.Events) != 1 || frame.Events[0].Type != 1 {
+			t.Fatalf("unexpected frame: %+v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame delivered")
+	}
+}
+
+func TestQueuedMotionIsMerged(t *testing.T) {
+	client := dialFakeHelper(t, &events.InputFrame{Events: []events.InputEvent{
+		{Type: 2, Code: 0, Value: 1},
+		{Type: 0, Code: 0},
+	}})
+
+	// the first frame is held by the forwarder so the rest build up behind it as a single frame
+	waitForQueue(t, client, func(queue []queuedEvent) bool {
+		return len(queue) == 1 && queue[0].frame.Events[0].Value >= 10
+	})
+}
@@ -0,0 +1,31 @@
+package helper
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID gives the uid of the process on the other end of the socket
+func peerUID(con *net.UnixConn) (uint32, error) {
+	raw, err := con.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return cred.Uid, nil
+}
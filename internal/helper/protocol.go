@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// op identifies the kind of message sent over the helper socket
+type op uint8
+
+const (
+	// opFrame carries an input frame, from the helper they have been read from the local devices and
+	// from the main process they are to be written to the virtual device
+	opFrame op = iota
+	// opMirrorInput carries input for a mirror device, main process to helper only
+	opMirrorInput
+	// opMirrored carries a message from a local device that is mirrored on another peer, helper to main
+	// process only
+	opMirrored
+	// opCall asks the helper to run one of the device operations
+	opCall
+	// opResult is the helpers reply to a call
+	opResult
+)
+
+// Device operations the main process can call, the helper refuses anything else
+const (
+	callGrabAccess      = "grab_access"
+	callGrabKeyboards   = "grab_keyboards"
+	callReleaseAccess   = "release_access"
+	callMirroredDevices = "mirrored_devices"
+	callAttachMirror    = "attach_mirror"
+	callDetachMirror    = "detach_mirror"
+	callMoveCursor      = "move_cursor"
+	callKeyRepeat       = "key_repeat"
+	callSetKeyRepeat    = "set_key_repeat"
+	callTypeText        = "type_text"
+)
+
+// largest message either side will accept, anything bigger is treated as a protocol error
+const maxMessageSize = 1 << 20
+
+// message sent in either direction over the helper socket
+// each message is prefixed with its length as a big endian uint32
+type message struct {
+	Op op `msgpack:"o"`
+	// ID pairs a result with its call
+	ID   uint32 `msgpack:"i,omitempty"`
+	Call string `msgpack:"c,omitempty"`
+	// Data is the msgpack encoded payload, mirrored messages carry the websocket message as is
+	Data  []byte `msgpack:"d,omitempty"`
+	Error string `msgpack:"e,omitempty"`
+}
+
+type detachArgs struct {
+	Source uuid.UUID `msgpack:"s"`
+	ID     string    `msgpack:"i"`
+}
+
+type typeTextArgs struct {
+	Text     string        `msgpack:"t"`
+	KeyMap   device.KeyMap `msgpack:"k"`
+	DelayMs  int64         `msgpack:"d"`
+	Fallback bool          `msgpack:"f"`
+}
+
+// newMessage builds a message with the payload marshaled into its data
+func newMessage(o op, payload any) (*message, error) {
+	msg := &message{Op: o}
+	if payload == nil {
+		return msg, nil
+	}
+
+	data, err := msgpack.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Data = data
+	return msg, nil
+}
+
+// writeMessage to the socket
+func writeMessage(w io.Writer, msg *message) error {
+	data, err := msgpack.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("message too large: %d bytes", len(data))
+	}
+
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+
+	_, err = w.Write(append(buf, data...))
+	return err
+}
+
+// readMessage from the socket
+func readMessage(r *bufio.Reader) (*message, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := msgpack.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,303 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Server is the privileged side of the helper
+// it owns the DeviceManager and serves a single unprivileged main process at a time over a unix socket
+type Server struct {
+	ctx      *common.Context
+	dev      *device.DeviceManager
+	listener *net.UnixListener
+	// uid of the user allowed to connect
+	uid uint32
+	// connection to the main process, nil while nobody is connected
+	con      *net.UnixConn
+	mux      sync.Mutex
+	writeMux sync.Mutex
+}
+
+// Listen on the configured socket
+// the socket is only accessible to the configured user
+func Listen(ctx *common.Context, dev *device.DeviceManager) (*Server, error) {
+	path := ctx.Config.Helper.Socket
+	if path == "" {
+		return nil, errors.New("no helper socket configured")
+	}
+
+	account, err := user.Lookup(ctx.Config.Helper.User)
+	if err != nil {
+		return nil, fmt.Errorf("unknown helper user: %w", err)
+	}
+
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := strconv.Atoi(account.Gid)
+	if err != nil {
+		return nil, err
+	}
+
+	// clear up the socket from a previous run
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on helper socket: %w", err)
+	}
+
+	if err := os.Chown(path, int(uid), gid); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &Server{
+		ctx:      ctx,
+		dev:      dev,
+		listener: listener,
+		uid:      uint32(uid),
+	}, nil
+}
+
+// Serve connections from the main process
+// this will block until the listener is closed
+func (srv *Server) Serve() error {
+	go srv.forwardDeviceEvents()
+
+	go func() {
+		<-srv.ctx.Done()
+		srv.listener.Close()
+	}()
+
+	for {
+		con, err := srv.listener.AcceptUnix()
+		if err != nil {
+			return err
+		}
+
+		uid, err := peerUID(con)
+		if err != nil || (uid != srv.uid && uid != 0) {
+			Logf("helper", "rejected connection from uid %d", uid)
+			con.Close()
+			continue
+		}
+
+		Log("helper", "main process connected")
+		srv.handle(con)
+		Log("helper", "main process disconnected")
+	}
+}
+
+// Close the helper socket
+func (srv *Server) Close() error {
+	return srv.listener.Close()
+}
+
+// handle messages from the main process until it disconnects
+func (srv *Server) handle(con *net.UnixConn) {
+	srv.mux.Lock()
+	srv.con = con
+	srv.mux.Unlock()
+
+	defer func() {
+		srv.mux.Lock()
+		srv.con = nil
+		srv.mux.Unlock()
+
+		con.Close()
+
+		// never leave the devices grabbed with nobody to send their input to
+		srv.dev.ReleaseAccess()
+	}()
+
+	reader := bufio.NewReader(con)
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+
+		switch msg.Op {
+		case opFrame:
+			var frame events.InputFrame
+			if err := msgpack.Unmarshal(msg.Data, &frame); err == nil {
+				srv.dev.Input <- &frame
+			}
+
+		case opMirrorInput:
+			var input events.DeviceInput
+			if err := msgpack.Unmarshal(msg.Data, &input); err == nil {
+				srv.dev.MirrorInput <- &input
+			}
+
+		case opCall:
+			// typing text takes as long as the text is so it must not hold up other messages
+			if msg.Call == callTypeText {
+				go srv.reply(msg)
+			} else {
+				srv.reply(msg)
+			}
+
+		default:
+			Logf("helper", "unexpected message: %d", msg.Op)
+			return
+		}
+	}
+}
+
+// reply to a call from the main process with its result
+func (srv *Server) reply(msg *message) {
+	result, err := srv.call(msg)
+
+	reply, merr := newMessage(opResult, result)
+	if merr != nil {
+		reply, err = &message{Op: opResult}, merr
+	}
+
+	reply.ID = msg.ID
+	if err != nil {
+		reply.Error = err.Error()
+	}
+
+	srv.send(reply)
+}
+
+// call runs one of the allowed device operations
+func (srv *Server) call(msg *message) (any, error) {
+	switch msg.Call {
+	case callGrabAccess:
+		return nil, srv.dev.GrabAccess()
+
+	case callGrabKeyboards:
+		return nil, srv.dev.GrabKeyboards()
+
+	case callReleaseAccess:
+		return nil, srv.dev.ReleaseAccess()
+
+	case callMirroredDevices:
+		return srv.dev.MirroredDevices(), nil
+
+	case callAttachMirror:
+		var info events.DeviceAttached
+		if err := msgpack.Unmarshal(msg.Data, &info); err != nil {
+			return nil, err
+		}
+
+		return nil, srv.dev.AttachMirror(&info)
+
+	case callDetachMirror:
+		var args detachArgs
+		if err := msgpack.Unmarshal(msg.Data, &args); err != nil {
+			return nil, err
+		}
+
+		return nil, srv.dev.DetachMirror(args.Source, args.ID)
+
+	case callMoveCursor:
+		var delta common.Vector2
+		if err := msgpack.Unmarshal(msg.Data, &delta); err != nil {
+			return nil, err
+		}
+
+		srv.dev.MoveCursor(delta)
+		return nil, nil
+
+	case callKeyRepeat:
+		return srv.dev.KeyRepeat(), nil
+
+	case callSetKeyRepeat:
+		var repeat events.KeyRepeat
+		if err := msgpack.Unmarshal(msg.Data, &repeat); err != nil {
+			return nil, err
+		}
+
+		srv.dev.SetKeyRepeat(repeat)
+		return nil, nil
+
+	case callTypeText:
+		var args typeTextArgs
+		if err := msgpack.Unmarshal(msg.Data, &args); err != nil {
+			return nil, err
+		}
+
+		srv.dev.TypeText(args.Text, args.KeyMap, time.Duration(args.DelayMs)*time.Millisecond, args.Fallback)
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown call: %s", msg.Call)
+	}
+}
+
+// forwardDeviceEvents from the local devices to the main process
+// events are dropped while nobody is connected
+func (srv *Server) forwardDeviceEvents() {
+	for {
+		var (
+			msg *message
+			err error
+		)
+
+		select {
+		case <-srv.ctx.Done():
+			return
+
+		case frame := <-srv.dev.Events:
+			msg, err = newMessage(opFrame, frame)
+
+		case mirrored := <-srv.dev.Mirrored:
+			var data []byte
+			if data, err = mirrored.Marshal(); err == nil {
+				msg = &message{Op: opMirrored, Data: data}
+			}
+		}
+
+		if err != nil {
+			Logf("helper", "failed to marshal device event: %s", err)
+			continue
+		}
+
+		srv.send(msg)
+	}
+}
+
+// send a message to the main process if it is connected
+func (srv *Server) send(msg *message) {
+	srv.mux.Lock()
+	con := srv.con
+	srv.mux.Unlock()
+
+	if con == nil {
+		return
+	}
+
+	srv.writeMux.Lock()
+	defer srv.writeMux.Unlock()
+
+	if err := writeMessage(con, msg); err != nil {
+		Logf("helper", "write failed: %s", err)
+	}
+}
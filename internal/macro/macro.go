@@ -0,0 +1,164 @@
+package macro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// default file the macros are stored in if none is configured
+const DefaultFile = "macros.json"
+
+var ErrNotFound = errors.New("macro not found")
+
+// Store holds the cluster wide macros and persists them to file on every change
+type Store struct {
+	path   string
+	macros []events.Macro
+	mux    sync.Mutex
+}
+
+// Load the macro store from file
+// a missing file is treated as an empty store
+func Load(path string) (*Store, error) {
+	if path == "" {
+		path = DefaultFile
+	}
+
+	store := &Store{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read macros: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.macros); err != nil {
+		return nil, fmt.Errorf("failed to parse macros: %w", err)
+	}
+
+	return store, nil
+}
+
+// All of the macros in the store
+func (s *Store) All() []events.Macro {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]events.Macro(nil), s.macros...)
+}
+
+// Bindings gives all the macros without their steps so they can be synced to peers
+func (s *Store) Bindings() events.MacrosUpdated {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	bindings := make(events.MacrosUpdated, 0, len(s.macros))
+	for _, macro := range s.macros {
+		macro.Steps = nil
+		bindings = append(bindings, macro)
+	}
+
+	return bindings
+}
+
+// Find a macro by name
+func (s *Store) Find(name string) (events.Macro, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if i := s.index(name); i != -1 {
+		return s.macros[i], true
+	}
+
+	return events.Macro{}, false
+}
+
+// Add a newly recorded macro to the store
+// the macro will be named after the first free slot which is also returned so that it can be
+// given a default chord
+func (s *Store) Add(steps []events.MacroStep) (events.Macro, int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	slot := 1
+	for s.index(slotName(slot)) != -1 {
+		slot++
+	}
+
+	macro := events.Macro{
+		Name:  slotName(slot),
+		Steps: steps,
+	}
+
+	s.macros = append(s.macros, macro)
+
+	return macro, slot, s.save()
+}
+
+// Bind a macro to a chord and target peer
+func (s *Store) Bind(name string, chord []uint16, target string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := s.index(name)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	s.macros[i].Chord = chord
+	s.macros[i].Target = target
+
+	return s.save()
+}
+
+// Remove a macro from the store
+func (s *Store) Remove(name string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := s.index(name)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	s.macros = append(s.macros[:i], s.macros[i+1:]...)
+
+	return s.save()
+}
+
+func (s *Store) index(name string) int {
+	for i, macro := range s.macros {
+		if macro.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// save the macros to file
+// they are written to a temp file first so a failed write cannot lose the existing macros
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.macros, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write macros: %w", err)
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func slotName(slot int) string {
+	return fmt.Sprintf("macro-%d", slot)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// size of the random nonces exchanged during the handshake
+const NonceSize = 32
+
+// Roles bind a proof to the side of the handshake that made it so that a proof cannot be reflected
+// back at the peer that sent it
+const (
+	RoleClient = "harmony-client"
+	RoleServer = "harmony-server"
+	// RoleDiscovery binds a proof to a discovery packet so that it cant be reused in the handshake
+	RoleDiscovery = "harmony-discovery"
+)
+
+// NewNonce generates a random nonce for a challenge
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return nonce, nil
+}
+
+// Proof that the sender knows the cluster secret
+// it is a HMAC of the role and both nonces keyed with the secret
+func Proof(secret, role string, nonces ...[]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role))
+
+	for _, nonce := range nonces {
+		mac.Write(nonce)
+	}
+
+	return mac.Sum(nil)
+}
+
+// Verify a proof sent by the other side of the handshake
+func Verify(secret, role string, proof []byte, nonces ...[]byte) bool {
+	return hmac.Equal(proof, Proof(secret, role, nonces...))
+}
+
+// ValidNonce checks that a nonce from the other side is the right size
+func ValidNonce(nonce []byte) bool {
+	return len(nonce) == NonceSize
+}
@@ -0,0 +1,124 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// default paths for the servers certificate and key, relative to the working directory
+const (
+	DefaultCertFile = "harmony.crt"
+	DefaultKeyFile  = "harmony.key"
+)
+
+// how long a generated certificate is valid for, peers pin the fingerprint so there is little
+// value in rotating it
+const certLifetime = 10 * 365 * 24 * time.Hour
+
+// LoadOrCreate loads the certificate and key from disk, generating a new self signed pair on first run
+func LoadOrCreate(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" {
+		certFile = DefaultCertFile
+	}
+	if keyFile == "" {
+		keyFile = DefaultKeyFile
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		return cert, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return cert, err
+	}
+
+	if err := generate(certFile, keyFile); err != nil {
+		return cert, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// Fingerprint is the sha256 of the leaf certificate in its DER encoding
+func Fingerprint(cert tls.Certificate) []byte {
+	if len(cert.Certificate) == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	return sum[:]
+}
+
+// FormatFingerprint formats a fingerprint as colon separated hex for displaying to the user
+func FormatFingerprint(fingerprint []byte) string {
+	parts := make([]string, len(fingerprint))
+	for i, b := range fingerprint {
+		parts[i] = hex.EncodeToString([]byte{b})
+	}
+
+	return strings.ToUpper(strings.Join(parts, ":"))
+}
+
+// generate a self signed certificate and write it and its key to disk
+func generate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"harmony"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePem(keyFile, "EC PRIVATE KEY", keyDer, 0600); err != nil {
+		return err
+	}
+
+	return writePem(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePem(path, typ string, data []byte, perm os.FileMode) error {
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	return pem.Encode(fh, &pem.Block{Type: typ, Bytes: data})
+}
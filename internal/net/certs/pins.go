@@ -0,0 +1,159 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// default file that pinned server fingerprints are stored in
+const DefaultPinFile = "known_servers.json"
+
+// ErrCertChanged is returned when a server presents a different certificate to the one pinned for it
+var ErrCertChanged = errors.New("server certificate has changed")
+
+// ErrNotPinned is returned when a server with no pin advertised no fingerprint to check its certificate against
+var ErrNotPinned = errors.New("server certificate is not trusted")
+
+// PinStore tracks the certificate fingerprints of servers that have been trusted on first use
+type PinStore struct {
+	path string
+	// hex encoded fingerprints keyed by server address
+	pins map[string]string
+	mux  sync.Mutex
+}
+
+// LoadPins loads the pin store from file
+// a missing file is treated as an empty store
+func LoadPins(path string) (*PinStore, error) {
+	if path == "" {
+		path = DefaultPinFile
+	}
+
+	store := &PinStore{path: path, pins: make(map[string]string)}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read known servers: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.pins); err != nil {
+		return nil, fmt.Errorf("failed to parse known servers: %w", err)
+	}
+
+	return store, nil
+}
+
+// Get the pinned fingerprint for a server
+func (s *PinStore) Get(address string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pin, ok := s.pins[address]
+	if !ok {
+		return nil, false
+	}
+
+	fingerprint, err := hex.DecodeString(pin)
+	return fingerprint, err == nil
+}
+
+// Pin a servers fingerprint, replacing any existing pin
+func (s *PinStore) Pin(address string, fingerprint []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pins[address] = hex.EncodeToString(fingerprint)
+	return s.save()
+}
+
+// Forget the pin for a server so that its certificate is trusted again on next connect
+func (s *PinStore) Forget(address string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.pins, address)
+	return s.save()
+}
+
+// TLSConfig for connecting to the server at address
+//
+// the certificate is self signed so the usual chain verification is replaced with a pin check,
+// on first connect the certificate is accepted if it matches the fingerprint the server advertised,
+// servers that advertised nothing are refused until they are pinned with the trust command
+//
+// the returned commit pins the certificate that was accepted, it must only be called once the server
+// has proven it knows the cluster secret so that a host failing authentication is never pinned
+func (s *PinStore) TLSConfig(address string, advertised []byte) (config *tls.Config, commit func() error) {
+	var accepted []byte
+
+	commit = func() error {
+		if accepted == nil {
+			return nil
+		}
+
+		if pinned, ok := s.Get(address); ok && bytes.Equal(pinned, accepted) {
+			return nil
+		}
+
+		return s.Pin(address, accepted)
+	}
+
+	config = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+
+			sum := sha256.Sum256(rawCerts[0])
+			fingerprint := sum[:]
+
+			if pinned, ok := s.Get(address); ok {
+				if !bytes.Equal(pinned, fingerprint) {
+					return fmt.Errorf("%w: %s now presents %s", ErrCertChanged, address, FormatFingerprint(fingerprint))
+				}
+
+				return nil
+			}
+
+			if advertised == nil {
+				return fmt.Errorf("%w: %s, trust it first with: harmony-hid trust %s", ErrNotPinned, address, address)
+			}
+
+			if !bytes.Equal(advertised, fingerprint) {
+				return errors.New("server certificate does not match the advertised fingerprint")
+			}
+
+			accepted = fingerprint
+			return nil
+		},
+	}
+
+	return config, commit
+}
+
+func (s *PinStore) save() error {
+	data, err := json.MarshalIndent(s.pins, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write known servers: %w", err)
+	}
+
+	return os.Rename(tmp, s.path)
+}
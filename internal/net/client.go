@@ -1,9 +1,12 @@
 package net
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -11,10 +14,20 @@ import (
 	"github.com/indeedhat/harmony/internal/config"
 	"github.com/indeedhat/harmony/internal/events"
 	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/auth"
+	"github.com/indeedhat/harmony/internal/net/certs"
+	"github.com/indeedhat/harmony/internal/net/udp"
 	"github.com/indeedhat/harmony/internal/screens"
+	"github.com/indeedhat/harmony/internal/trust"
 	"golang.org/x/net/context"
 )
 
+// number of outgoing messages that can back up before the sender blocks
+const inputBufferSize = 64
+
+// how long the server has to complete the auth handshake
+const authTimeout = 10 * time.Second
+
 type Client struct {
 	Input chan events.WsMessage
 	// Events coming from the server
@@ -25,29 +38,99 @@ type Client struct {
 	config   *config.Config
 	ws       *websocket.Conn
 	uuid     uuid.UUID
+	identity *trust.Identity
+	host     string
+	// challenge the server sent during the auth handshake, the peer signs it to prove its identity
+	challenge []byte
+
+	// udp data channel for input frames, nil until the server offers one or after it fails
+	datagram *udp.Channel
+	// signalled when the data channel gives up so the consumer can fall back to the websocket
+	datagramFailed chan struct{}
+	datagramMux    sync.Mutex
+
+	// listener for direct channels opened by other peers, nil if direct input is disabled
+	directListener *udp.Listener
+	directPort     uint16
+	// direct channels opened to or accepted from other peers by session
+	directChannels map[uint32]*udp.Channel
+	// channel the server routed frames over, nil while they go through the server
+	directRoute *udp.Channel
+	// channel the consumer is actually sending frames over, it only follows the route once nothing is
+	// held so that a release can never overtake its press by going down the other path
+	directActive *udp.Channel
+	// keys and buttons held down in the frames sent to the focused peer, only used by the consumer
+	held map[uint16]bool
+	// session the server last routed frames over
+	directSession uint32
+	// sessions that failed, the consumer tells the server about them
+	directFailed chan uint32
+	directMux    sync.Mutex
 }
 
 // NewClient harmony client
-func NewClient(ctx *common.Context, uuid uuid.UUID, ip string, screens []screens.DisplayBounds) (*Client, error) {
+// fingerprint is the certificate fingerprint the server advertised, it is pinned if this is the first
+// time connecting to the server
+func NewClient(
+	ctx *common.Context,
+	identity *trust.Identity,
+	ip string,
+	fingerprint []byte,
+	screens []screens.DisplayBounds,
+) (*Client, error) {
 	serverAddress := fmt.Sprintf("%s:%d", ip, ctx.Config.Server.Port)
-	u := url.URL{Scheme: "ws", Host: serverAddress, Path: "/ws"}
+	u := url.URL{Scheme: "wss", Host: serverAddress, Path: "/ws"}
+
+	pins, err := certs.LoadPins(ctx.Config.Security.KnownServers)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, commitPin := pins.TLSConfig(serverAddress, fingerprint)
 
-	ws, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+
+	ws, _, err := dialer.Dial(u.String(), nil)
+	if errors.Is(err, certs.ErrCertChanged) {
+		return nil, fmt.Errorf("%w, re-approve it with: harmony-hid trust %s", err, serverAddress)
+	} else if err != nil {
+		return nil, err
+	}
+
+	challenge, err := authenticate(ws, ctx.Config.Security.ClusterSecret)
 	if err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	if err := commitPin(); err != nil {
+		ws.Close()
 		return nil, err
 	}
 
 	cntx, ctxClose := context.WithCancel(context.Background())
 	client := &Client{
-		uuid:     uuid,
+		uuid:     identity.UUID,
+		identity: identity,
 		ctx:      cntx,
 		ctxClose: ctxClose,
 		config:   ctx.Config,
 		ws:       ws,
-		Events:   make(chan []byte),
-		Input:    make(chan events.WsMessage),
+		host:     ip,
+
+		challenge: challenge,
+		Events:    make(chan []byte),
+		Input:     make(chan events.WsMessage, inputBufferSize),
+
+		datagramFailed: make(chan struct{}, 1),
+		directChannels: make(map[uint32]*udp.Channel),
+		held:           make(map[uint16]bool),
+		directFailed:   make(chan uint32, 8),
 	}
 
+	client.listenDirect()
+
 	go client.readEventsFromServer()
 	go client.consumeIncommingMessages()
 
@@ -56,9 +139,77 @@ func NewClient(ctx *common.Context, uuid uuid.UUID, ip string, screens []screens
 	return client, nil
 }
 
+// authenticate with the server by answering its challenge then verifying its own proof
+// this happens before any other messages are exchanged
+// the servers challenge is returned so that the peer can sign it with its identity
+func authenticate(ws *websocket.Conn, secret string) ([]byte, error) {
+	ws.SetReadDeadline(time.Now().Add(authTimeout))
+	defer ws.SetReadDeadline(time.Time{})
+
+	challenge, err := readAuthMessage[events.AuthChallenge](ws, events.MsgTypeAuthChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.ValidNonce(challenge.Nonce) {
+		return nil, errors.New("bad challenge")
+	}
+
+	nonce, err := auth.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	response := events.AuthResponse{
+		Nonce: nonce,
+		Proof: auth.Proof(secret, auth.RoleClient, challenge.Nonce, nonce),
+	}
+
+	data, err := response.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return nil, err
+	}
+
+	result, err := readAuthMessage[events.AuthResult](ws, events.MsgTypeAuthResult)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.Verify(secret, auth.RoleServer, result.Proof, nonce, challenge.Nonce) {
+		return nil, errors.New("server does not know the cluster secret")
+	}
+
+	return challenge.Nonce, nil
+}
+
+// readAuthMessage reads the next message from the server expecting it to be of the given type
+func readAuthMessage[T any](ws *websocket.Conn, typ events.MsgType) (*T, error) {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 2 || events.MsgType(data[0]) != typ {
+		return nil, errors.New("unexpected message during handshake")
+	}
+
+	msg := events.Unmarshal[T](data[2:])
+	if msg == nil {
+		return nil, errors.New("bad handshake message")
+	}
+
+	return msg, nil
+}
+
 // Close the client
 func (cnt *Client) Close() error {
 	cnt.ctxClose()
+	cnt.closeDatagram()
+	cnt.closeAllDirect()
 	return cnt.ws.Close()
 }
 
@@ -75,9 +226,13 @@ func (cnt *Client) sendConnect(screens []screens.DisplayBounds) {
 	}
 
 	msg := &events.ClientConnect{
-		Hostname: hostname,
-		UUID:     cnt.uuid,
-		Displays: screens,
+		Hostname:   hostname,
+		UUID:       cnt.uuid,
+		Displays:   screens,
+		Udp:        cnt.config.Transport.Udp,
+		DirectPort: cnt.directPort,
+		PublicKey:  cnt.identity.PublicKey(),
+		Signature:  cnt.identity.Sign(cnt.challenge),
 	}
 
 	Log("app", "sending connect")
@@ -85,40 +240,145 @@ func (cnt *Client) sendConnect(screens []screens.DisplayBounds) {
 }
 
 // readEventsFromServer and pass the hid events out to the application via the InputEvents chanel
+// a connection that stops hearing the servers pings is treated as dropped
 func (cnt *Client) readEventsFromServer() {
+	cnt.ws.SetReadDeadline(time.Now().Add(config.PongWait))
+	cnt.ws.SetPingHandler(func(data string) error {
+		cnt.ws.SetReadDeadline(time.Now().Add(config.PongWait))
+
+		err := cnt.ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+
+		return err
+	})
+
 	for {
 		_, data, err := cnt.ws.ReadMessage()
 		if err != nil {
-			if _, ok := err.(*websocket.CloseError); ok {
-				cnt.Close()
-				return
+			// gorilla connections are done after any read error, reading again would just fail again
+			if _, ok := err.(*websocket.CloseError); !ok {
+				Logf("client", "read error: %s", err)
 			}
-			Logf("client", "read error: %s", err)
+
+			cnt.Close()
+			return
+		}
+
+		if cnt.handleTransportMessage(data) {
 			continue
 		}
 
-		cnt.Events <- data
+		select {
+		case cnt.Events <- data:
+		case <-cnt.ctx.Done():
+			return
+		}
+	}
+}
+
+// handleTransportMessage deals with the messages that set up the udp channels
+// these never reach the application, true is returned if the message was one of them
+func (cnt *Client) handleTransportMessage(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+
+	switch events.MsgType(data[0]) {
+	case events.MsgTypeUdpOffer:
+		go cnt.openDatagram(data)
+
+	case events.MsgTypeDirectRoute:
+		cnt.handleDirectRoute(data)
+
+	case events.MsgTypeDirectAccept:
+		cnt.handleDirectAccept(data)
+
+	case events.MsgTypeDirectRevoke:
+		cnt.handleDirectRevoke(data)
+
+	default:
+		return false
 	}
+
+	return true
 }
 
 func (cnt *Client) consumeIncommingMessages() {
+	var next events.WsMessage
+
 	for {
-		select {
-		case <-cnt.ctx.Done():
-			Log("client", "done")
-			return
+		msg := next
+		next = nil
 
-		case msg := <-cnt.Input:
-			data, err := msg.Marshal()
-			if err != nil {
-				Logf("client", "failed to marshal event: %s", err)
+		if msg == nil {
+			select {
+			case <-cnt.ctx.Done():
+				Log("client", "done")
+				return
+
+			case <-cnt.datagramFailed:
+				cnt.fallBackToWs()
+				continue
+
+			case session := <-cnt.directFailed:
+				cnt.dropDirect(session)
 				continue
 
+			case msg = <-cnt.Input:
+			}
+		}
+
+		frame, isFrame := msg.(*events.InputFrame)
+		if isFrame {
+			frame, next = cnt.coalesceMotion(frame)
+			msg = frame
+		}
+
+		data, err := msg.Marshal()
+		if err != nil {
+			Logf("client", "failed to marshal event: %s", err)
+			continue
+
+		}
+
+		// pinned frames always go through the server as it is the one that knows where they go
+		if isFrame && frame.Target == "" {
+			sent := cnt.sendDirect(data, !frame.IsMotion())
+			frame.TrackHeld(cnt.held)
+
+			if sent {
+				continue
 			}
+		}
+
+		if isFrame && cnt.sendDatagram(data, !frame.IsMotion()) {
+			continue
+		}
+
+		cnt.writeWs(data)
+	}
+}
 
-			if err := cnt.ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
-				Logf("client", "ws write failed: %s", err)
+// coalesceMotion merges any motion frames that have backed up behind the given one while the
+// connection was busy
+// the first other message found is returned as next so it can be sent in order
+func (cnt *Client) coalesceMotion(frame *events.InputFrame) (merged *events.InputFrame, next events.WsMessage) {
+	for frame.IsMotion() {
+		select {
+		case msg := <-cnt.Input:
+			queued, ok := msg.(*events.InputFrame)
+			if !ok || !queued.IsMotion() || queued.Target != frame.Target {
+				return frame, msg
 			}
+
+			frame = frame.Merge(queued)
+
+		default:
+			return frame, nil
 		}
 	}
+
+	return frame, nil
 }
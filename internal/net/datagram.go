@@ -0,0 +1,114 @@
+package net
+
+import (
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/udp"
+)
+
+// openDatagram channel from the offer sent by the server
+// input frames keep going over the websocket if the channel cant be opened
+func (cnt *Client) openDatagram(data []byte) {
+	offer := events.Unmarshal[events.UdpOffer](data[2:])
+	if offer == nil {
+		Log("client", "bad udp offer")
+		return
+	}
+
+	ch, err := udp.Dial(
+		cnt.host,
+		offer,
+		cnt.config.Transport.LossPercent,
+		cnt.receiveDatagram,
+		cnt.signalDatagramFailed,
+	)
+	if err != nil {
+		Logf("client", "udp channel unavailable, using the websocket: %s", err)
+		return
+	}
+
+	cnt.datagramMux.Lock()
+	defer cnt.datagramMux.Unlock()
+
+	select {
+	case <-cnt.ctx.Done():
+		ch.Close()
+		return
+	default:
+	}
+
+	Log("client", "udp channel open")
+	cnt.datagram = ch
+}
+
+// receiveDatagram passes input frames from the server out to the application
+func (cnt *Client) receiveDatagram(data []byte) {
+	if len(data) < 2 || events.MsgType(data[0]) != events.MsgTypeInputFrame {
+		return
+	}
+
+	select {
+	case cnt.Events <- data:
+	case <-cnt.ctx.Done():
+	}
+}
+
+func (cnt *Client) signalDatagramFailed() {
+	select {
+	case cnt.datagramFailed <- struct{}{}:
+	default:
+	}
+}
+
+// sendDatagram sends a frame over the data channel
+// false is returned if the frame should be sent over the websocket instead
+// this must only be called from the consumer as it may write to the websocket
+func (cnt *Client) sendDatagram(data []byte, reliable bool) bool {
+	cnt.datagramMux.Lock()
+	ch := cnt.datagram
+	cnt.datagramMux.Unlock()
+
+	if ch == nil {
+		return false
+	}
+
+	if ch.Send(data, reliable) {
+		return true
+	}
+
+	if ch.Failed() {
+		cnt.fallBackToWs()
+	}
+
+	return false
+}
+
+// fallBackToWs closes the data channel and resends anything that was never acked over the websocket
+// this must only be called from the consumer as gorilla only allows a single writer
+func (cnt *Client) fallBackToWs() {
+	cnt.datagramMux.Lock()
+	ch := cnt.datagram
+	cnt.datagram = nil
+	cnt.datagramMux.Unlock()
+
+	if ch == nil {
+		return
+	}
+
+	ch.Close()
+	Log("client", "udp channel failed, falling back to the websocket")
+
+	for _, data := range ch.Pending() {
+		cnt.writeWs(data)
+	}
+}
+
+func (cnt *Client) closeDatagram() {
+	cnt.datagramMux.Lock()
+	defer cnt.datagramMux.Unlock()
+
+	if cnt.datagram != nil {
+		cnt.datagram.Close()
+		cnt.datagram = nil
+	}
+}
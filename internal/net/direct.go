@@ -0,0 +1,252 @@
+package net
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/udp"
+)
+
+// directTokenTTL is how long a session the server set up is accepted for before the source opens it
+const directTokenTTL = 10 * time.Second
+
+// listenDirect for input sent straight from other peers if it is enabled
+func (cnt *Client) listenDirect() {
+	cfg := cnt.config.Transport
+	if !cfg.Direct {
+		return
+	}
+
+	port := cfg.DirectPort
+	if port == 0 {
+		port = cnt.config.Server.Port + 2
+	}
+
+	listener, err := udp.Listen(port, cfg.LossPercent)
+	if err != nil {
+		Logf("client", "direct input disabled: %s", err)
+		return
+	}
+
+	cnt.directListener = listener
+	cnt.directPort = uint16(port)
+}
+
+// handleDirectRoute from the server
+// frames go over the routed session once it is open and through the server until then
+func (cnt *Client) handleDirectRoute(data []byte) {
+	route := events.Unmarshal[events.DirectRoute](data[2:])
+	if route == nil {
+		return
+	}
+
+	cnt.directMux.Lock()
+	defer cnt.directMux.Unlock()
+
+	cnt.directRoute = nil
+	cnt.directSession = route.Session
+
+	if route.Session == 0 {
+		return
+	}
+
+	if ch, ok := cnt.directChannels[route.Session]; ok {
+		cnt.directRoute = ch
+		return
+	}
+
+	go cnt.openDirect(route)
+}
+
+// openDirect channel to the target of a route
+func (cnt *Client) openDirect(route *events.DirectRoute) {
+	session := route.Session
+	offer := &events.UdpOffer{
+		Session: session,
+		Key:     route.Key,
+		Port:    route.Port,
+	}
+
+	ch, err := udp.Dial(
+		route.Address,
+		offer,
+		cnt.config.Transport.LossPercent,
+		func([]byte) {},
+		func() { cnt.signalDirectFailed(session) },
+	)
+	if err != nil {
+		Logf("client", "direct channel to %s unavailable: %s", route.Target, err)
+		cnt.signalDirectFailed(session)
+		return
+	}
+
+	cnt.directMux.Lock()
+	defer cnt.directMux.Unlock()
+
+	select {
+	case <-cnt.ctx.Done():
+		ch.Close()
+		return
+	default:
+	}
+
+	Logf("client", "sending input directly to %s", route.Target)
+	cnt.directChannels[session] = ch
+	if cnt.directSession == session {
+		cnt.directRoute = ch
+	}
+}
+
+// handleDirectAccept from the server, the source has a short time to open the session
+func (cnt *Client) handleDirectAccept(data []byte) {
+	accept := events.Unmarshal[events.DirectAccept](data[2:])
+	if accept == nil || cnt.directListener == nil {
+		return
+	}
+
+	ch, err := cnt.directListener.Accept(accept.Session, accept.Key, cnt.receiveDatagram, func() {})
+	if err != nil {
+		Logf("client", "failed to accept direct channel from %s: %s", accept.Source, err)
+		return
+	}
+
+	cnt.directMux.Lock()
+	cnt.directChannels[accept.Session] = ch
+	cnt.directMux.Unlock()
+
+	time.AfterFunc(directTokenTTL, func() {
+		select {
+		case <-ch.Ready():
+		default:
+			cnt.revokeDirect(accept.Session)
+		}
+	})
+}
+
+// handleDirectRevoke from the server
+func (cnt *Client) handleDirectRevoke(data []byte) {
+	if revoke := events.Unmarshal[events.DirectRevoke](data[2:]); revoke != nil {
+		cnt.revokeDirect(revoke.Session)
+	}
+}
+
+// revokeDirect closes the channel for a session
+func (cnt *Client) revokeDirect(session uint32) {
+	cnt.directMux.Lock()
+	ch := cnt.takeDirect(session)
+	cnt.directMux.Unlock()
+
+	if ch != nil {
+		cnt.closeDirect(ch)
+	}
+}
+
+// takeDirect channel for a session out of the client
+// the lock must be held
+func (cnt *Client) takeDirect(session uint32) *udp.Channel {
+	ch, ok := cnt.directChannels[session]
+	if !ok {
+		return nil
+	}
+
+	delete(cnt.directChannels, session)
+	if cnt.directRoute == ch {
+		cnt.directRoute = nil
+	}
+
+	return ch
+}
+
+func (cnt *Client) closeDirect(ch *udp.Channel) {
+	if cnt.directListener != nil {
+		cnt.directListener.Remove(ch)
+		return
+	}
+
+	ch.Close()
+}
+
+func (cnt *Client) signalDirectFailed(session uint32) {
+	select {
+	case cnt.directFailed <- session:
+	case <-cnt.ctx.Done():
+	}
+}
+
+// sendDirect sends a frame straight to the peer the server routed this one to
+// false is returned if the frame should go through the server instead
+// this must only be called from the consumer as it may write to the websocket
+func (cnt *Client) sendDirect(data []byte, reliable bool) bool {
+	cnt.directMux.Lock()
+	route := cnt.directRoute
+	cnt.directMux.Unlock()
+
+	// the route is only switched between strokes, the two paths are not ordered with each other
+	if route != cnt.directActive && len(cnt.held) == 0 {
+		cnt.directActive = route
+	}
+
+	ch := cnt.directActive
+	if ch == nil {
+		return false
+	}
+
+	if ch.Send(data, reliable) {
+		return true
+	}
+
+	if ch.Failed() {
+		cnt.dropDirect(ch.Session())
+	}
+
+	return false
+}
+
+// dropDirect channel that failed, anything that was never acked is sent through the server and the
+// server is told so that it stops routing the pair directly
+// this must only be called from the consumer as gorilla only allows a single writer
+func (cnt *Client) dropDirect(session uint32) {
+	cnt.directMux.Lock()
+	ch := cnt.takeDirect(session)
+	cnt.directMux.Unlock()
+
+	if cnt.directActive != nil && cnt.directActive.Session() == session {
+		cnt.directActive = nil
+	}
+
+	if ch != nil {
+		cnt.closeDirect(ch)
+		Log("client", "direct channel failed, sending input through the server")
+
+		for _, data := range ch.Pending() {
+			cnt.writeWs(data)
+		}
+	}
+
+	revoke := events.DirectRevoke{Session: session}
+	if data, err := revoke.Marshal(); err == nil {
+		cnt.writeWs(data)
+	}
+}
+
+// closeAllDirect channels and stop accepting new ones
+func (cnt *Client) closeAllDirect() {
+	cnt.directMux.Lock()
+	defer cnt.directMux.Unlock()
+
+	for session := range cnt.directChannels {
+		cnt.closeDirect(cnt.takeDirect(session))
+	}
+
+	if cnt.directListener != nil {
+		cnt.directListener.Close()
+	}
+}
+
+func (cnt *Client) writeWs(data []byte) {
+	if err := cnt.ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		Logf("client", "ws write failed: %s", err)
+	}
+}
@@ -32,11 +32,23 @@ type message struct {
 	ServerPort uint16  `msgpack:"p"`
 	ClusterId  string  `msgpack:"i"`
 	StartTime  int64   `msgpack:"s"`
+	// Fingerprint of the servers tls certificate
+	Fingerprint []byte `msgpack:"f,omitempty"`
+	// Timestamp and Nonce protect against replayed packets
+	Timestamp int64  `msgpack:"ts"`
+	Nonce     []byte `msgpack:"n"`
+	// Mac proves the sender knows the cluster secret, it covers every other field
+	Mac []byte `msgpack:"m,omitempty"`
 }
 
+// big enough for any message including the certificate fingerprint and mac
+const maxMessageSize = 256
+
 type Server struct {
 	IpAddress string
 	Port      uint16
+	// Fingerprint of the certificate the server advertised, peers pin it on first connect
+	Fingerprint []byte
 }
 
 type Service struct {
@@ -52,6 +64,10 @@ type Service struct {
 	minPeerTime int64
 	// group id for the cluster peers
 	clusterId string
+	// fingerprint of this peers certificate, advertised when it is the server
+	fingerprint []byte
+	// nonces of recently recieved packets
+	nonces *nonceCache
 	// current state of the discovery service
 	state peerState
 	ctx   *common.Context
@@ -78,6 +94,7 @@ func New(ctx *common.Context) (*Service, error) {
 		Server:    make(chan Server),
 		clusterId: ctx.Config.Discovery.ClusterId,
 		state:     stateDiscovery,
+		nonces:    newNonceCache(),
 		ctx:       ctx,
 		addr:      addr,
 		con:       con,
@@ -97,6 +114,20 @@ func (svc *Service) Run() (err error) {
 	return
 }
 
+// Serve skips negotiation and goes straight into server mode, answering discovery requests from peers
+func (svc *Service) Serve() {
+	svc.startTime = time.Now().UnixMilli()
+	svc.state = stateServer
+
+	go svc.listen()
+}
+
+// SetFingerprint sets the certificate fingerprint that is advertised to peers while running as the server
+// it must be called before the service is started
+func (svc *Service) SetFingerprint(fingerprint []byte) {
+	svc.fingerprint = fingerprint
+}
+
 // Close the discovery service
 func (svc *Service) Close() {
 	svc.con.Close()
@@ -150,7 +181,7 @@ func (svc *Service) discover() {
 // listen for messages from peers and respond appropriately
 func (svc *Service) listen() {
 	for {
-		buf := make([]byte, 44)
+		buf := make([]byte, maxMessageSize)
 		_, addr, err := svc.con.ReadFromUDP(buf)
 		if err != nil {
 			Log("discovery", "read failed")
@@ -163,6 +194,12 @@ func (svc *Service) listen() {
 			continue
 		}
 
+		// packets from anything that doesnt know the cluster secret are ignored entirely
+		if err := svc.verify(&msg); err != nil {
+			Logf("discovery", "ignoring message from %s: %s", addr, err)
+			continue
+		}
+
 		Logf("discovery", "handling message: %d", msg.Type)
 		switch msg.Type {
 		case serverResponse:
@@ -176,8 +213,9 @@ func (svc *Service) listen() {
 			// allow enough time for the server to be fully started (in case it is in the process)
 			time.Sleep(3 * time.Second)
 			svc.Server <- Server{
-				IpAddress: addr.IP.String(),
-				Port:      msg.ServerPort,
+				IpAddress:   addr.IP.String(),
+				Port:        msg.ServerPort,
+				Fingerprint: msg.Fingerprint,
 			}
 			return
 
@@ -204,17 +242,19 @@ func (svc *Service) listen() {
 }
 
 func (svc *Service) serverMsg() ([]byte, error) {
-	return msgpack.Marshal(&message{
+	return svc.sign(&message{
 		StartTime:  svc.startTime,
 		Type:       serverResponse,
 		ApiVersion: config.ApiVersion,
 		ServerPort: uint16(svc.ctx.Config.Server.Port),
 		ClusterId:  svc.ctx.Config.Discovery.ClusterId,
+
+		Fingerprint: svc.fingerprint,
 	})
 }
 
 func (svc *Service) discoveryMsg() ([]byte, error) {
-	return msgpack.Marshal(&message{
+	return svc.sign(&message{
 		StartTime:  svc.startTime,
 		Type:       queryPeers,
 		ApiVersion: config.ApiVersion,
@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/indeedhat/harmony/internal/net/auth"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// how far a packets timestamp can be from the local clock before it is rejected
+// nonces are remembered for twice this long so a packet cant be replayed while it is still fresh
+const maxClockSkew = 30 * time.Second
+
+// size of the random nonce sent with every packet
+const packetNonceSize = 16
+
+var (
+	errUnauthenticated = errors.New("unauthenticated message")
+	errReplayed        = errors.New("replayed message")
+)
+
+// sign the message with the cluster secret and marshal it for sending
+func (svc *Service) sign(msg *message) ([]byte, error) {
+	nonce, err := auth.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Timestamp = time.Now().UnixMilli()
+	msg.Nonce = nonce[:packetNonceSize]
+	msg.Mac = nil
+
+	body, err := msgpack.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Mac = auth.Proof(svc.ctx.Config.Security.ClusterSecret, auth.RoleDiscovery, body)
+
+	return msgpack.Marshal(msg)
+}
+
+// verify that the message was sent by a peer that knows the cluster secret and is not a replay
+// the mac is checked before the timestamp so only peers in the cluster are reported for clock skew
+func (svc *Service) verify(msg *message) error {
+	if len(msg.Mac) == 0 || len(msg.Nonce) != packetNonceSize {
+		return errUnauthenticated
+	}
+
+	unsigned := *msg
+	unsigned.Mac = nil
+
+	body, err := msgpack.Marshal(&unsigned)
+	if err != nil {
+		return errUnauthenticated
+	}
+
+	if !auth.Verify(svc.ctx.Config.Security.ClusterSecret, auth.RoleDiscovery, msg.Mac, body) {
+		return errUnauthenticated
+	}
+
+	age := time.Since(time.UnixMilli(msg.Timestamp))
+	if age > maxClockSkew || age < -maxClockSkew {
+		return fmt.Errorf("timestamp is %s off the local clock, check both peers sync their time", age.Round(time.Second))
+	}
+
+	if !svc.nonces.add(string(msg.Nonce)) {
+		return errReplayed
+	}
+
+	return nil
+}
+
+// nonceCache remembers the nonces of recently seen packets
+type nonceCache struct {
+	seen map[string]time.Time
+	mux  sync.Mutex
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// add a nonce to the cache, returns false if it has already been seen
+func (cache *nonceCache) add(nonce string) bool {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+
+	now := time.Now()
+	for seen, expires := range cache.seen {
+		if now.After(expires) {
+			delete(cache.seen, seen)
+		}
+	}
+
+	if _, ok := cache.seen[nonce]; ok {
+		return false
+	}
+
+	cache.seen[nonce] = now.Add(2 * maxClockSkew)
+	return true
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/indeedhat/harmony/internal/net/server/socket"
+)
+
+type API struct {
+	socket *socket.Socket
+}
+
+// New API controller
+func New(router *gin.Engine, socket *socket.Socket) *API {
+	api := &API{
+		socket: socket,
+	}
+
+	api.routes(router)
+
+	return api
+}
+
+func (api *API) routes(router *gin.Engine) {
+	group := router.Group("/api", api.RequireSecret())
+
+	group.POST("/type", api.TypeText())
+
+	group.GET("/macros", api.ListMacros())
+	group.PUT("/macros/:name", api.BindMacro())
+	group.DELETE("/macros/:name", api.RemoveMacro())
+
+	group.GET("/broadcast", api.BroadcastState())
+	group.PUT("/broadcast", api.StartBroadcast())
+	group.DELETE("/broadcast", api.StopBroadcast())
+
+	group.GET("/peers", api.ListPeers())
+	group.POST("/peers/:uuid/approve", api.ApprovePeer())
+	group.DELETE("/peers/:uuid", api.RevokePeer())
+
+	group.GET("/audit", api.Audit())
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/indeedhat/harmony/internal/audit"
+)
+
+// default number of entries returned when no limit is given
+const defaultAuditLimit = 100
+
+// Audit controller
+// queries the audit log, filtering by the since (RFC3339), event, peer (uuid) and limit query params
+func (api *API) Audit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := audit.Query{
+			Event: ctx.Query("event"),
+			Peer:  ctx.Query("peer"),
+			Limit: defaultAuditLimit,
+		}
+
+		if since := ctx.Query("since"); since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 time"})
+				return
+			}
+
+			query.Since = t
+		}
+
+		if limit := ctx.Query("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n < 0 {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "bad limit"})
+				return
+			}
+
+			query.Limit = n
+		}
+
+		entries, err := api.socket.Audit().Query(query)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireSecret middleware
+// rejects requests that dont carry the cluster secret as a bearer token
+func (api *API) RequireSecret() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		secret := api.socket.ClusterSecret()
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "bad cluster secret"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
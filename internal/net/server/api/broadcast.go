@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BroadcastState controller
+func (api *API) BroadcastState() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, api.socket.BroadcastState())
+	}
+}
+
+// StartBroadcast controller
+// starts sending the keyboard input of the source peer to several peers at once
+func (api *API) StartBroadcast() gin.HandlerFunc {
+	type request struct {
+		// Source hostname, defaults to the servers own peer or when running as a coordinator the peer in control
+		Source string `json:"source"`
+		// Peers hostnames, defaults to all peers
+		Peers          []string `json:"peers"`
+		TimeoutSeconds int      `json:"timeout_seconds" binding:"min=0"`
+	}
+
+	return func(ctx *gin.Context) {
+		var req request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		timeout := time.Duration(req.TimeoutSeconds) * time.Second
+		if err := api.socket.StartBroadcast(req.Source, req.Peers, timeout); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, api.socket.BroadcastState())
+	}
+}
+
+// StopBroadcast controller
+func (api *API) StopBroadcast() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		api.socket.StopBroadcast()
+		ctx.Status(http.StatusNoContent)
+	}
+}
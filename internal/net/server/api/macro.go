@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/macro"
+)
+
+// ListMacros controller
+// lists the macros bindings for the cluster
+func (api *API) ListMacros() gin.HandlerFunc {
+	type binding struct {
+		Name   string `json:"name"`
+		Chord  string `json:"chord"`
+		Target string `json:"target"`
+		Steps  int    `json:"steps"`
+	}
+
+	return func(ctx *gin.Context) {
+		macros := api.socket.Macros()
+
+		bindings := make([]binding, 0, len(macros))
+		for _, m := range macros {
+			bindings = append(bindings, binding{
+				Name:   m.Name,
+				Chord:  device.ChordString(m.Chord),
+				Target: m.Target,
+				Steps:  len(m.Steps),
+			})
+		}
+
+		ctx.JSON(http.StatusOK, bindings)
+	}
+}
+
+// BindMacro controller
+// binds a macro to a key chord and optionally a target peer
+func (api *API) BindMacro() gin.HandlerFunc {
+	type request struct {
+		Chord  string `json:"chord" binding:"required"`
+		Target string `json:"target"`
+	}
+
+	return func(ctx *gin.Context) {
+		var req request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		chord, err := device.ParseChord(req.Chord)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		macroError(ctx, api.socket.BindMacro(ctx.Param("name"), chord, req.Target))
+	}
+}
+
+// RemoveMacro controller
+func (api *API) RemoveMacro() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		macroError(ctx, api.socket.RemoveMacro(ctx.Param("name")))
+	}
+}
+
+// macroError writes the appropriate response for the result of a macro change
+func macroError(ctx *gin.Context, err error) {
+	switch {
+	case err == nil:
+		ctx.Status(http.StatusNoContent)
+	case errors.Is(err, macro.ErrNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
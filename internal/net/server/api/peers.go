@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/net/server/socket"
+)
+
+// ListPeers controller
+// lists the pending and trusted peers along with their status
+func (api *API) ListPeers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		peers := api.socket.Peers()
+		if peers == nil {
+			peers = []socket.PeerState{}
+		}
+
+		ctx.JSON(http.StatusOK, peers)
+	}
+}
+
+// ApprovePeer controller
+func (api *API) ApprovePeer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := uuid.Parse(ctx.Param("uuid"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "bad peer uuid"})
+			return
+		}
+
+		peerError(ctx, api.socket.ApprovePeer(id))
+	}
+}
+
+// RevokePeer controller
+// revokes a trusted peer or rejects a pending one
+func (api *API) RevokePeer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := uuid.Parse(ctx.Param("uuid"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "bad peer uuid"})
+			return
+		}
+
+		peerError(ctx, api.socket.RevokePeer(id))
+	}
+}
+
+// peerError writes the appropriate response for the result of a peer change
+func peerError(ctx *gin.Context, err error) {
+	switch {
+	case err == nil:
+		ctx.Status(http.StatusNoContent)
+	case errors.Is(err, socket.ErrPeerNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, socket.ErrServerPeer):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
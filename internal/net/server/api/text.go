@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// TypeText controller
+// types the given string out on the target or focused peer
+func (api *API) TypeText() gin.HandlerFunc {
+	type request struct {
+		Text    string `json:"text" binding:"required"`
+		DelayMs uint16 `json:"delay_ms"`
+		// Target hostname, defaults to wherever the servers own peer, or the peer in control, has keyboard focus
+		Target string `json:"target"`
+	}
+
+	return func(ctx *gin.Context) {
+		var req request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := api.socket.TypeText(req.Target, &events.TypeText{
+			Text:    req.Text,
+			DelayMs: req.DelayMs,
+		})
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.Status(http.StatusAccepted)
+	}
+}
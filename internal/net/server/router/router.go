@@ -1,27 +1,66 @@
 package router
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
 	"mime"
+	"net/http"
+	"time"
 
 	"github.com/foolin/goview"
 	"github.com/foolin/goview/supports/ginview"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
 	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/macro"
+	"github.com/indeedhat/harmony/internal/net/server/api"
 	"github.com/indeedhat/harmony/internal/net/server/socket"
 	"github.com/indeedhat/harmony/internal/net/server/ui"
 	"github.com/indeedhat/harmony/internal/screens"
+	"github.com/indeedhat/harmony/internal/trust"
 )
 
 // New UI controller group
-func New(ctx *common.Context, serverUUID uuid.UUID, displays []screens.DisplayBounds) *gin.Engine {
+// serverKey is the identity key of the peer running the server, it is nil if no peer runs with the server
+func New(
+	ctx *common.Context,
+	serverUUID uuid.UUID,
+	serverKey ed25519.PublicKey,
+	displays []screens.DisplayBounds,
+) *gin.Engine {
 	mime.AddExtensionType(".js", "application/javascript")
 	router := gin.Default()
 
-	screenManager := screens.NewScreenManager()
+	layout, err := screens.LoadLayout(ctx.Config.Server.LayoutFile)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	_ = ui.New(router, screenManager)
-	_ = socket.New(ctx, serverUUID, router, screenManager)
+	screenManager := screens.NewScreenManager(layout)
+
+	macros, err := macro.Load(ctx.Config.Macros.File)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trusted, err := trust.Load(ctx.Config.Security.TrustedPeers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auditLog, err := audit.Open(ctx.Config.Security.AuditLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	soc := socket.New(ctx, serverUUID, serverKey, router, screenManager, macros, trusted, auditLog)
+	_ = ui.New(router, screenManager, soc)
+	_ = api.New(router, soc)
 
 	viewsConfig := goview.DefaultConfig
 	viewsConfig.Root = "./web/views"
@@ -32,3 +71,34 @@ func New(ctx *common.Context, serverUUID uuid.UUID, displays []screens.DisplayBo
 
 	return router
 }
+
+// how long open requests get to finish once the server is shutting down
+const shutdownTimeout = 5 * time.Second
+
+// RunTLS serves the router over https on the configured port using the servers certificate
+// this will block until the server stops or the context is cancelled
+func RunTLS(ctx *common.Context, router *gin.Engine, cert tls.Certificate) error {
+	srv := &http.Server{
+		Addr:    fmt.Sprint(":", ctx.Config.Server.Port),
+		Handler: router,
+		TLSConfig: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
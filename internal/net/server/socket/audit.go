@@ -0,0 +1,52 @@
+package socket
+
+import (
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+)
+
+// Audit log of the server
+func (soc *Socket) Audit() *audit.Log {
+	return soc.audit
+}
+
+// peerEntry starts an audit entry for an event caused by the given peer
+func (soc *Socket) peerEntry(event string, id uuid.UUID) audit.Entry {
+	return audit.Entry{
+		Event:    event,
+		Peer:     id.String(),
+		Hostname: soc.hostnameOf(id),
+	}
+}
+
+// disconnectEntry for a peer whose connection has gone
+func (soc *Socket) disconnectEntry(con *ConnectionWrapper, id uuid.UUID) audit.Entry {
+	entry := soc.peerEntry(audit.EventDisconnect, id)
+	entry.Address = con.Soc.RemoteAddr().String()
+
+	return entry
+}
+
+// targetEntry starts an audit entry for an event caused by one peer that affects another
+func (soc *Socket) targetEntry(event string, id, target uuid.UUID) audit.Entry {
+	entry := soc.peerEntry(event, id)
+	entry.Target = target.String()
+	entry.TargetHostname = soc.hostnameOf(target)
+
+	return entry
+}
+
+// hostnameOf a connected or pending peer
+func (soc *Socket) hostnameOf(id uuid.UUID) string {
+	if pending, ok := soc.pending[id]; ok {
+		return pending.info.Hostname
+	}
+
+	for _, peer := range soc.screenManager.Snapshot() {
+		if peer.UUID == id {
+			return peer.Hostname
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,95 @@
+package socket
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/indeedhat/harmony/internal/events"
+	"github.com/indeedhat/harmony/internal/net/auth"
+	"github.com/indeedhat/harmony/internal/trust"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// sendChallenge to a newly connected peer
+// the nonce is returned so that the response can be verified against it
+func (soc *Socket) sendChallenge(con *ConnectionWrapper) ([]byte, error) {
+	nonce, err := auth.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := events.AuthChallenge{Nonce: nonce}
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	con.send(data)
+
+	return nonce, nil
+}
+
+// authenticate the peers response to the challenge and prove the servers own knowledge of the
+// secret in return
+func (soc *Socket) authenticate(con *ConnectionWrapper, nonce []byte, data []byte) bool {
+	if events.MsgType(data[0]) != events.MsgTypeAuthResponse {
+		return false
+	}
+
+	var msg events.AuthResponse
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		return false
+	}
+
+	secret := soc.appCtx.Config.Security.ClusterSecret
+	if !auth.ValidNonce(msg.Nonce) || !auth.Verify(secret, auth.RoleClient, msg.Proof, nonce, msg.Nonce) {
+		return false
+	}
+
+	result := events.AuthResult{Proof: auth.Proof(secret, auth.RoleServer, msg.Nonce, nonce)}
+	if data, err := result.Marshal(); err == nil {
+		con.send(data)
+	}
+
+	return true
+}
+
+// ClusterSecret that peers and api clients must know
+func (soc *Socket) ClusterSecret() string {
+	return soc.appCtx.Config.Security.ClusterSecret
+}
+
+// checkIdentity proof sent with a peers connect message
+// a reason is returned if the peer should be turned away
+func (soc *Socket) checkIdentity(con *ConnectionWrapper, msg *events.ClientConnect, challenge []byte) string {
+	if !trust.VerifyIdentity(msg.UUID, msg.PublicKey, challenge, msg.Signature) {
+		return "bad identity proof"
+	}
+
+	// only the peer running alongside the server may use its identity
+	if msg.UUID == soc.serverUUID {
+		if len(soc.serverKey) == 0 || !bytes.Equal(msg.PublicKey, soc.serverKey) || !isLoopback(con) {
+			return "claimed the server identity"
+		}
+
+		return ""
+	}
+
+	// a peer that changed its key has to be revoked and approved again
+	if peer, ok := soc.trusted.Lookup(msg.UUID); ok && len(peer.PublicKey) != 0 &&
+		!bytes.Equal(peer.PublicKey, msg.PublicKey) {
+		return "identity key does not match the approved peer"
+	}
+
+	return ""
+}
+
+func isLoopback(con *ConnectionWrapper) bool {
+	host, _, err := net.SplitHostPort(con.Soc.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,221 @@
+package socket
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// broadcasting input stops on its own after this long unless configured otherwise
+const defaultBroadcastTimeout = 5 * time.Minute
+
+// broadcastInput tracks the peers that keyboard input is being fanned out to
+type broadcastInput struct {
+	state events.BroadcastState
+	peers []uuid.UUID
+	timer *time.Timer
+}
+
+// handleToggleBroadcast starts broadcasting the peers keyboard to the configured peers or stops it
+// if it is already running
+func (soc *Socket) handleToggleBroadcast(conUUID *uuid.UUID) {
+	if soc.broadcasting.state.Active {
+		soc.stopBroadcast()
+		return
+	}
+
+	conf := soc.appCtx.Config.Broadcast
+	timeout := time.Duration(conf.TimeoutSeconds) * time.Second
+
+	if err := soc.startBroadcast(*conUUID, conf.Peers, timeout); err != nil {
+		Logf("server", "failed to start broadcast: %s", err)
+	}
+}
+
+// StartBroadcast of the source peers keyboard to the given peers
+// source defaults to the default source peer and peers to every connected peer
+func (soc *Socket) StartBroadcast(source string, peers []string, timeout time.Duration) error {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	sourceID, ok := soc.defaultSource()
+	if source == "" && !ok {
+		return errors.New("no source peer connected")
+	}
+
+	if source != "" {
+		peer := soc.screenManager.FindPeerByHostname(source)
+		if peer == nil {
+			return errors.New("source peer not connected")
+		}
+
+		sourceID = peer.UUID
+	}
+
+	return soc.startBroadcast(sourceID, peers, timeout)
+}
+
+// StopBroadcast of keyboard input
+func (soc *Socket) StopBroadcast() {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	soc.stopBroadcast()
+}
+
+// BroadcastState gives the current state of broadcast input
+func (soc *Socket) BroadcastState() events.BroadcastState {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	// the peers are copied as forgetBroadcastPeer edits them in place
+	state := soc.broadcasting.state
+	state.Peers = append([]string(nil), state.Peers...)
+
+	return state
+}
+
+func (soc *Socket) startBroadcast(source uuid.UUID, hostnames []string, timeout time.Duration) error {
+	if _, ok := soc.clients[source]; !ok {
+		return errors.New("source peer not connected")
+	}
+
+	if timeout <= 0 {
+		timeout = defaultBroadcastTimeout
+	}
+
+	var (
+		ids   []uuid.UUID
+		names []string
+	)
+
+	if len(hostnames) == 0 {
+		for _, peer := range soc.screenManager.Snapshot() {
+			ids = append(ids, peer.UUID)
+			names = append(names, peer.Hostname)
+		}
+	} else {
+		for _, hostname := range hostnames {
+			if peer := soc.screenManager.FindPeerByHostname(hostname); peer != nil {
+				ids = append(ids, peer.UUID)
+				names = append(names, peer.Hostname)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return errors.New("no peers to broadcast to")
+	}
+
+	if soc.broadcasting.timer != nil {
+		soc.broadcasting.timer.Stop()
+	}
+
+	// the lock is held until the timer has been stored so the timeout always sees its own timer
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		soc.broadcastTimeout(timer)
+	})
+
+	soc.broadcasting = broadcastInput{
+		state: events.BroadcastState{
+			Active: true,
+			Source: source,
+			Peers:  names,
+			Until:  time.Now().Add(timeout).Unix(),
+		},
+		peers: ids,
+		timer: timer,
+	}
+
+	Logf("server", "broadcasting keyboard input to %v", names)
+
+	entry := soc.peerEntry(audit.EventBroadcastStart, source)
+	entry.Detail = strings.Join(names, ",")
+	soc.audit.Record(entry)
+	soc.broadcast(&soc.broadcasting.state)
+	soc.updateDirectRoutes()
+
+	return nil
+}
+
+func (soc *Socket) stopBroadcast() {
+	if !soc.broadcasting.state.Active {
+		return
+	}
+
+	soc.broadcasting.timer.Stop()
+	soc.broadcasting = broadcastInput{
+		state: events.BroadcastState{Source: soc.broadcasting.state.Source},
+	}
+
+	Log("server", "broadcast stopped")
+	soc.audit.Record(soc.peerEntry(audit.EventBroadcastStop, soc.broadcasting.state.Source))
+	soc.broadcast(&soc.broadcasting.state)
+	soc.updateDirectRoutes()
+}
+
+// broadcastTimeout stops the broadcast the timer was started for
+// a timer that fired just as a broadcast was restarted or stopped is ignored
+func (soc *Socket) broadcastTimeout(timer *time.Timer) {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	if soc.broadcasting.timer != timer {
+		return
+	}
+
+	Log("server", "broadcast timed out")
+	soc.stopBroadcast()
+}
+
+// forwardBroadcastFrame sends the keyboard events of a frame to all of the broadcast peers
+// the pointer events are returned so they can follow focus as normal
+func (soc *Socket) forwardBroadcastFrame(source uuid.UUID, frame *events.InputFrame) *events.InputFrame {
+	keyboard, pointer := device.SplitPointer(frame)
+	if keyboard == nil {
+		return pointer
+	}
+
+	for _, id := range soc.broadcasting.peers {
+		if _, ok := soc.clients[id]; ok {
+			soc.sendFrame(source, id, keyboard)
+		}
+	}
+
+	return pointer
+}
+
+// forgetBroadcastPeer removes a disconnected peer from the broadcast
+// broadcasting stops if it was the source or there is nobody left to send to
+func (soc *Socket) forgetBroadcastPeer(id uuid.UUID) {
+	if !soc.broadcasting.state.Active {
+		return
+	}
+
+	if soc.broadcasting.state.Source == id {
+		soc.stopBroadcast()
+		return
+	}
+
+	for i, peer := range soc.broadcasting.peers {
+		if peer == id {
+			soc.broadcasting.peers = append(soc.broadcasting.peers[:i], soc.broadcasting.peers[i+1:]...)
+			soc.broadcasting.state.Peers = append(soc.broadcasting.state.Peers[:i], soc.broadcasting.state.Peers[i+1:]...)
+			break
+		}
+	}
+
+	if len(soc.broadcasting.peers) == 0 {
+		soc.stopBroadcast()
+		return
+	}
+
+	soc.broadcast(&soc.broadcasting.state)
+}
@@ -0,0 +1,159 @@
+package socket
+
+import (
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type mirrorKey struct {
+	source uuid.UUID
+	id     string
+}
+
+// mirror tracks a device on one peer that is being mirrored onto another
+type mirror struct {
+	info *events.DeviceAttached
+	// peers that have been sent the device details and will have created a mirror device
+	attached map[uuid.UUID]bool
+}
+
+// handleDeviceAttached registers a device that the peer wants mirroring on another peer
+func (soc *Socket) handleDeviceAttached(conUUID *uuid.UUID, data []byte) {
+	var msg events.DeviceAttached
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal device attached")
+		return
+	}
+
+	Logf("server", "device attached: %s -> %s", msg.Name, msg.Target)
+	msg.Source = *conUUID
+
+	soc.mirrors[mirrorKey{*conUUID, msg.ID}] = &mirror{
+		info:     &msg,
+		attached: make(map[uuid.UUID]bool),
+	}
+}
+
+// handleDeviceDetached removes the mirror device from all peers it was attached to
+func (soc *Socket) handleDeviceDetached(conUUID *uuid.UUID, data []byte) {
+	var msg events.DeviceDetached
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal device detached")
+		return
+	}
+
+	soc.detachMirror(mirrorKey{*conUUID, msg.ID})
+}
+
+// handleDeviceInput forwards a frame of events from a mirrored device to its target peer
+func (soc *Socket) handleDeviceInput(conUUID *uuid.UUID, data []byte) {
+	var msg events.DeviceInput
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal device input")
+		return
+	}
+
+	m, ok := soc.mirrors[mirrorKey{*conUUID, msg.ID}]
+	if !ok {
+		return
+	}
+
+	target, ok := soc.mirrorTarget(m)
+	if !ok {
+		return
+	}
+
+	client := soc.clients[target]
+	if !m.attached[target] {
+		info := *m.info
+		if info.Class == events.DeviceClassTablet {
+			info.Area, _ = soc.screenManager.PeerArea(target)
+		}
+
+		data, err := info.Marshal()
+		if err != nil {
+			return
+		}
+
+		soc.queueSend(client, data)
+		m.attached[target] = true
+	}
+
+	msg.Source = *conUUID
+	if data, err := msg.Marshal(); err == nil {
+		soc.queueSend(client, data)
+	}
+}
+
+// mirrorTarget finds the connected peer that a mirrored device should be sent to
+// devices without an assigned target follow focus
+func (soc *Socket) mirrorTarget(m *mirror) (uuid.UUID, bool) {
+	var target uuid.UUID
+
+	if m.info.Target == "" {
+		// gamepads go wherever the keyboard is, touchpads and tablets follow the pointer
+		f, ok := soc.focus[m.info.Source]
+		if !ok {
+			return target, false
+		}
+
+		focused := f.pointer
+		if m.info.Class == events.DeviceClassGamepad {
+			focused = f.keyboard
+		}
+
+		if focused == nil {
+			return target, false
+		}
+
+		target = *focused
+	} else {
+		peer := soc.screenManager.FindPeerByHostname(m.info.Target)
+		if peer == nil {
+			return target, false
+		}
+
+		target = peer.UUID
+	}
+
+	if _, ok := soc.clients[target]; !ok || target == m.info.Source {
+		return target, false
+	}
+
+	return target, true
+}
+
+// detachMirror tells all the peers with a mirror of the device to remove it
+func (soc *Socket) detachMirror(key mirrorKey) {
+	m, ok := soc.mirrors[key]
+	if !ok {
+		return
+	}
+
+	delete(soc.mirrors, key)
+
+	data, err := (&events.DeviceDetached{ID: key.id, Source: key.source}).Marshal()
+	if err != nil {
+		return
+	}
+
+	for target := range m.attached {
+		if client, ok := soc.clients[target]; ok {
+			soc.queueSend(client, data)
+		}
+	}
+}
+
+// forgetMirrors cleans up the mirror state for a disconnected peer
+func (soc *Socket) forgetMirrors(conUUID uuid.UUID) {
+	for key, m := range soc.mirrors {
+		if key.source == conUUID {
+			soc.detachMirror(key)
+			continue
+		}
+
+		delete(m.attached, conUUID)
+	}
+}
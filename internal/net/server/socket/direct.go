@@ -0,0 +1,279 @@
+package socket
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/udp"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// directLinger is how long a session is kept for reuse once input stops going over it
+	directLinger = 30 * time.Second
+	// directRetryAfter is how long a pair of peers that failed to connect directly use the relay
+	directRetryAfter = time.Minute
+)
+
+// directPeer is where a peer accepts direct input
+type directPeer struct {
+	host string
+	port uint16
+}
+
+// directKey identifies the pair of peers a direct session is for
+type directKey struct {
+	source uuid.UUID
+	target uuid.UUID
+}
+
+type directSession struct {
+	session uint32
+	key     []byte
+	// idle revokes the session if it goes unused, nil while it is routed
+	idle *time.Timer
+}
+
+// directRoutes tracks the direct input paths between peers
+type directRoutes struct {
+	peers    map[uuid.UUID]directPeer
+	sessions map[directKey]*directSession
+	// routes each source is currently sending its input over
+	routes map[uuid.UUID]directKey
+	// pairs that failed to connect and when they can try again
+	failed map[directKey]time.Time
+}
+
+func newDirectRoutes() directRoutes {
+	return directRoutes{
+		peers:    make(map[uuid.UUID]directPeer),
+		sessions: make(map[directKey]*directSession),
+		routes:   make(map[uuid.UUID]directKey),
+		failed:   make(map[directKey]time.Time),
+	}
+}
+
+// registerDirectPeer that accepts direct input
+// the server peer is left out as its input never goes through a relay anyway
+func (soc *Socket) registerDirectPeer(con *ConnectionWrapper, msg *events.ClientConnect) {
+	if msg.DirectPort == 0 || msg.UUID == soc.serverUUID {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(con.Soc.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+
+	soc.direct.peers[msg.UUID] = directPeer{host: host, port: msg.DirectPort}
+}
+
+// forgetDirectPeer revokes any sessions to or from a peer that has gone away
+func (soc *Socket) forgetDirectPeer(id uuid.UUID) {
+	delete(soc.direct.peers, id)
+
+	for key := range soc.direct.sessions {
+		if key.source == id || key.target == id {
+			soc.revokeDirect(key)
+		}
+	}
+
+	for key := range soc.direct.failed {
+		if key.source == id || key.target == id {
+			delete(soc.direct.failed, key)
+		}
+	}
+}
+
+// directTarget finds the peer that input from the source can be sent to directly
+//
+// input is only sent direct when the server would pass it through untouched, so never when the
+// sources focus is split, it is broadcasting, media keys are routed, the target has chords denied or
+// the source is not allowed to drive the target
+func (soc *Socket) directTarget(source uuid.UUID) (uuid.UUID, bool) {
+	if soc.appCtx.Config.LocalKeys.MediaHost != "" {
+		return uuid.Nil, false
+	}
+
+	if soc.broadcasting.state.Active && soc.broadcasting.state.Source == source {
+		return uuid.Nil, false
+	}
+
+	f, ok := soc.focus[source]
+	if !ok || f.pointer == nil || f.split() {
+		return uuid.Nil, false
+	}
+
+	target := *f.pointer
+	if target == source {
+		return uuid.Nil, false
+	}
+
+	if _, ok := soc.direct.peers[target]; !ok {
+		return uuid.Nil, false
+	}
+
+	if until, ok := soc.direct.failed[directKey{source, target}]; ok && time.Now().Before(until) {
+		return uuid.Nil, false
+	}
+
+	if len(soc.deniedChords(target)) > 0 || !soc.mayDrive(source, target) {
+		return uuid.Nil, false
+	}
+
+	return target, true
+}
+
+// updateDirectRoutes brings the routes of every source in line with where its focus is
+// this is called whenever focus or anything that affects routing may have changed
+func (soc *Socket) updateDirectRoutes() {
+	for source := range soc.direct.peers {
+		target, ok := soc.directTarget(source)
+		current, routed := soc.direct.routes[source]
+
+		if ok && routed && current.target == target {
+			continue
+		}
+
+		if routed {
+			soc.unrouteDirect(source, current)
+		}
+
+		if ok {
+			soc.routeDirect(source, target)
+		}
+	}
+}
+
+// routeDirect input from the source to the target, reusing the pairs session if it has one
+func (soc *Socket) routeDirect(source, target uuid.UUID) {
+	key := directKey{source, target}
+
+	sess, ok := soc.direct.sessions[key]
+	if !ok {
+		sess = soc.newDirectSession(key)
+		if sess == nil {
+			return
+		}
+	}
+
+	if sess.idle != nil {
+		sess.idle.Stop()
+		sess.idle = nil
+	}
+
+	peer := soc.direct.peers[target]
+	soc.direct.routes[source] = key
+
+	Logf("server", "routing input from %s directly to %s", source, target)
+	soc.sendTo(source, &events.DirectRoute{
+		Target:  target,
+		Address: peer.host,
+		Port:    peer.port,
+		Session: sess.session,
+		Key:     sess.key,
+	})
+}
+
+// unrouteDirect sends the sources input back through the server
+// the session is kept around for a while in case focus comes straight back
+func (soc *Socket) unrouteDirect(source uuid.UUID, key directKey) {
+	delete(soc.direct.routes, source)
+	soc.sendTo(source, &events.DirectRoute{})
+
+	sess, ok := soc.direct.sessions[key]
+	if !ok {
+		return
+	}
+
+	sess.idle = time.AfterFunc(directLinger, func() {
+		soc.mux.Lock()
+		defer soc.unlock()
+
+		if current, ok := soc.direct.sessions[key]; ok && current == sess && sess.idle != nil {
+			soc.revokeDirect(key)
+		}
+	})
+}
+
+// newDirectSession for the pair and let the target know to expect it
+func (soc *Socket) newDirectSession(key directKey) *directSession {
+	session, err := udp.NewSession()
+	if err != nil {
+		return nil
+	}
+
+	secret, err := udp.NewKey()
+	if err != nil {
+		return nil
+	}
+
+	sess := &directSession{session: session, key: secret}
+	soc.direct.sessions[key] = sess
+
+	soc.sendTo(key.target, &events.DirectAccept{
+		Source:  key.source,
+		Session: session,
+		Key:     secret,
+	})
+
+	return sess
+}
+
+// revokeDirect session and tell both ends to close it
+func (soc *Socket) revokeDirect(key directKey) {
+	sess, ok := soc.direct.sessions[key]
+	if !ok {
+		return
+	}
+
+	delete(soc.direct.sessions, key)
+	if sess.idle != nil {
+		sess.idle.Stop()
+	}
+
+	if current, ok := soc.direct.routes[key.source]; ok && current == key {
+		delete(soc.direct.routes, key.source)
+	}
+
+	revoke := &events.DirectRevoke{Session: sess.session}
+	soc.sendTo(key.source, revoke)
+	soc.sendTo(key.target, revoke)
+}
+
+// handleDirectRevoke from a source that could not reach its target
+// the pair go through the server for a while before trying again
+func (soc *Socket) handleDirectRevoke(conUUID *uuid.UUID, data []byte) {
+	var msg events.DirectRevoke
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal direct revoke")
+		return
+	}
+
+	for key, sess := range soc.direct.sessions {
+		if key.source != *conUUID || sess.session != msg.Session {
+			continue
+		}
+
+		Logf("server", "direct input from %s to %s failed, using the relay", key.source, key.target)
+		soc.direct.failed[key] = time.Now().Add(directRetryAfter)
+		soc.revokeDirect(key)
+		soc.updateDirectRoutes()
+		return
+	}
+}
+
+// sendTo a single connected peer
+func (soc *Socket) sendTo(id uuid.UUID, msg events.WsMessage) {
+	client, ok := soc.clients[id]
+	if !ok {
+		return
+	}
+
+	if data, err := msg.Marshal(); err == nil {
+		soc.queueSend(client, data)
+	}
+}
@@ -0,0 +1,388 @@
+package socket
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// focus tracks the peers that a source peers keyboard and pointer input are routed to
+// they move together when the pointer crosses a transition zone but keyboard focus can also be
+// moved on its own
+type focus struct {
+	keyboard *uuid.UUID
+	pointer  *uuid.UUID
+	// repeat settings of the source peer, restored when focus returns to it
+	repeat events.KeyRepeat
+	// since is when the source last took focus, used to find who got to a peer first
+	since time.Time
+}
+
+// set both keyboard and pointer focus to the peer
+func (f *focus) set(id uuid.UUID) {
+	keyboard, pointer := id, id
+	f.keyboard = &keyboard
+	f.pointer = &pointer
+	f.since = time.Now()
+}
+
+// active reports if any input is being routed to another peer
+func (f *focus) active() bool {
+	return f.keyboard != nil || f.pointer != nil
+}
+
+// split reports if keyboard and pointer input are being routed to different peers
+func (f *focus) split() bool {
+	if f.keyboard == nil || f.pointer == nil {
+		return f.keyboard != f.pointer
+	}
+
+	return *f.keyboard != *f.pointer
+}
+
+// has reports if the peer has either keyboard or pointer focus
+func (f *focus) has(id uuid.UUID) bool {
+	return (f.keyboard != nil && *f.keyboard == id) || (f.pointer != nil && *f.pointer == id)
+}
+
+// FocusState gives the source peers that have keyboard and pointer focus on each peer
+func (soc *Socket) FocusState() (keyboard, pointer map[uuid.UUID][]uuid.UUID) {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	keyboard = make(map[uuid.UUID][]uuid.UUID)
+	pointer = make(map[uuid.UUID][]uuid.UUID)
+
+	for source, f := range soc.focus {
+		if f.keyboard != nil && *f.keyboard != source {
+			keyboard[*f.keyboard] = append(keyboard[*f.keyboard], source)
+		}
+
+		if f.pointer != nil && *f.pointer != source {
+			pointer[*f.pointer] = append(pointer[*f.pointer], source)
+		}
+	}
+
+	return keyboard, pointer
+}
+
+// handleChangeFocus moves the focus of the source peer driving the pointer and lets the appropriate
+// peers know
+//
+// when a peer that is having its pointer driven by another source sends the change, it is that
+// source that is moving on, the sender is told to hand back the devices it grabbed
+// keyboard focus always follows the pointer into the new peer
+func (soc *Socket) handleChangeFocus(conUUID *uuid.UUID, data []byte) {
+	Log("server", "change focus")
+	defer soc.updateDirectRoutes()
+
+	var msg events.ChangeFocus
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal change focus")
+		return
+	}
+
+	target := msg.UUID
+	if _, ok := soc.clients[target]; !ok {
+		return
+	}
+
+	source := *conUUID
+	if controller, ok := soc.controllerOf(*conUUID); ok {
+		source = controller
+	}
+
+	f, ok := soc.focus[source]
+	if !ok {
+		f = &focus{repeat: msg.Repeat}
+		soc.focus[source] = f
+	}
+
+	switch {
+	case target == source:
+		Logf("server", "focus returned to %s", source)
+		soc.audit.Record(soc.targetEntry(audit.EventFocus, source, source))
+		delete(soc.focus, source)
+		soc.sendFocusRecieved(source, f.repeat)
+
+	case !soc.canFocus(source, target):
+		Logf("server", "focus on %s denied for %s", target, source)
+		soc.audit.Record(soc.targetEntry(audit.EventFocusDenied, source, target))
+		if *conUUID == source {
+			delete(soc.focus, source)
+			soc.sendFocusRecieved(source, f.repeat)
+			return
+		}
+
+	default:
+		Logf("server", "focus moved from %s to %s", source, target)
+		soc.audit.Record(soc.targetEntry(audit.EventFocus, source, target))
+		f.set(target)
+		soc.sendFocusRecieved(target, f.repeat)
+	}
+
+	// the previous target grabbed its devices when the pointer crossed its transition zone
+	if *conUUID != source {
+		soc.sendFocusRecieved(*conUUID, msg.Repeat)
+	}
+}
+
+// sendFocusRecieved to a peer so that it releases any devices it grabbed
+func (soc *Socket) sendFocusRecieved(id uuid.UUID, repeat events.KeyRepeat) {
+	client, ok := soc.clients[id]
+	if !ok {
+		return
+	}
+
+	msg := events.FocusRecieved{Repeat: repeat}
+	if data, err := msg.Marshal(); err == nil {
+		soc.queueSend(client, data)
+	}
+}
+
+// releaseSource clears the focus of a single source peer and tells it to take back its devices
+func (soc *Socket) releaseSource(source uuid.UUID) {
+	delete(soc.focus, source)
+	soc.updateDirectRoutes()
+
+	client, ok := soc.clients[source]
+	if !ok {
+		return
+	}
+
+	msg := events.ReleaseFocus{}
+	if data, err := msg.Marshal(); err == nil {
+		soc.queueSend(client, data)
+	}
+}
+
+// controllerOf finds the source peer whose pointer is on the given peer
+// if several sources are sharing the peer the one that has been there longest is used
+func (soc *Socket) controllerOf(id uuid.UUID) (uuid.UUID, bool) {
+	var (
+		controller uuid.UUID
+		since      time.Time
+		found      bool
+	)
+
+	for source, f := range soc.focus {
+		if source == id || f.pointer == nil || *f.pointer != id {
+			continue
+		}
+
+		if !found || f.since.Before(since) {
+			controller, since, found = source, f.since, true
+		}
+	}
+
+	return controller, found
+}
+
+// holderOf finds the source that has had keyboard or pointer focus on the peer the longest
+func (soc *Socket) holderOf(id uuid.UUID) (uuid.UUID, bool) {
+	var (
+		holder uuid.UUID
+		since  time.Time
+		found  bool
+	)
+
+	for source, f := range soc.focus {
+		if source == id || !f.has(id) {
+			continue
+		}
+
+		if !found || f.since.Before(since) {
+			holder, since, found = source, f.since, true
+		}
+	}
+
+	return holder, found
+}
+
+// canFocus applies the deny conflict policy to a source that wants to move focus onto the target
+func (soc *Socket) canFocus(source, target uuid.UUID) bool {
+	if soc.appCtx.Config.Focus.Conflict != config.FocusConflictDeny || target == source {
+		return true
+	}
+
+	holder, ok := soc.holderOf(target)
+	return !ok || holder == source
+}
+
+// mayDrive applies the first come conflict policy to input from a source going to the target
+// sources that arrive later are released back to their own devices as soon as they send input
+func (soc *Socket) mayDrive(source, target uuid.UUID) bool {
+	switch soc.appCtx.Config.Focus.Conflict {
+	case config.FocusConflictShare, config.FocusConflictDeny:
+		return true
+	}
+
+	if target == source {
+		return true
+	}
+
+	holder, ok := soc.holderOf(target)
+	return !ok || holder == source
+}
+
+// keyboardTarget gives the peer that keyboard input from the source is sent to
+func (soc *Socket) keyboardTarget(source uuid.UUID) uuid.UUID {
+	if f, ok := soc.focus[source]; ok && f.keyboard != nil {
+		return *f.keyboard
+	}
+
+	return source
+}
+
+// defaultSource is the peer that api requests act for when they dont name one
+// this is the servers own peer, or when running as a coordinator the peer currently in control of
+// another peer falling back to the first connected peer in the layout
+func (soc *Socket) defaultSource() (uuid.UUID, bool) {
+	if _, ok := soc.clients[soc.serverUUID]; ok {
+		return soc.serverUUID, true
+	}
+
+	var (
+		source uuid.UUID
+		since  time.Time
+		found  bool
+	)
+	for id, f := range soc.focus {
+		if _, ok := soc.clients[id]; !ok || f.pointer == nil || *f.pointer == id {
+			continue
+		}
+
+		if !found || f.since.Before(since) {
+			source, since, found = id, f.since, true
+		}
+	}
+
+	if found {
+		return source, true
+	}
+
+	for _, peer := range soc.screenManager.Snapshot() {
+		if _, ok := soc.clients[peer.UUID]; ok {
+			return peer.UUID, true
+		}
+	}
+
+	return uuid.Nil, false
+}
+
+// handleMoveKeyboardFocus moves the peers keyboard focus on its own leaving its pointer where it is
+//
+// keyboard focus is cycled through the peers in the order they joined, or returned to the peer with
+// pointer focus on reset
+// the requesting peer is told where keyboard focus ended up so that it can grab or release its keyboards
+func (soc *Socket) handleMoveKeyboardFocus(conUUID *uuid.UUID, data []byte) {
+	defer soc.updateDirectRoutes()
+
+	var msg events.MoveKeyboardFocus
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal move keyboard focus")
+		return
+	}
+
+	source := *conUUID
+	f, ok := soc.focus[source]
+	if !ok {
+		f = &focus{}
+	}
+
+	// without pointer focus the pointer is on the requesting peers own displays
+	pointer := source
+	if f.pointer != nil {
+		pointer = *f.pointer
+	}
+
+	keyboard := pointer
+	if f.keyboard != nil {
+		keyboard = *f.keyboard
+	}
+
+	next := pointer
+	if !msg.Reset {
+		next = soc.nextPeer(keyboard)
+	}
+
+	if soc.canFocus(source, next) {
+		keyboard = next
+	} else {
+		Logf("server", "keyboard focus on %s denied for %s", next, source)
+		soc.audit.Record(soc.targetEntry(audit.EventFocusDenied, source, next))
+	}
+
+	f.keyboard = &keyboard
+	f.pointer = &pointer
+	f.since = time.Now()
+	soc.focus[source] = f
+
+	// unsplit focus that ends up back on the requesting peer is no focus at all
+	if !f.split() && pointer == source {
+		delete(soc.focus, source)
+	}
+
+	Logf("server", "keyboard focus: %s pointer focus: %s", keyboard, pointer)
+	soc.audit.Record(soc.targetEntry(audit.EventKeyboardFocus, source, keyboard))
+
+	changed := events.KeyboardFocusChanged{UUID: keyboard}
+	if data, err := changed.Marshal(); err == nil {
+		soc.queueSend(soc.clients[source], data)
+	}
+}
+
+// nextPeer after the given one in the order the peers joined the cluster
+func (soc *Socket) nextPeer(id uuid.UUID) uuid.UUID {
+	peers := soc.screenManager.Snapshot()
+	for i, peer := range peers {
+		if peer.UUID == id {
+			return peers[(i+1)%len(peers)].UUID
+		}
+	}
+
+	if len(peers) == 0 {
+		return id
+	}
+
+	return peers[0].UUID
+}
+
+// forwardFocusedFrame routes a frame from the source to the peers it has focus on
+func (soc *Socket) forwardFocusedFrame(source uuid.UUID, f *focus, frame *events.InputFrame) {
+	if !f.split() {
+		soc.deliverFrame(source, *f.pointer, frame)
+		return
+	}
+
+	keyboard, pointer := device.SplitPointer(frame)
+
+	if keyboard != nil && f.keyboard != nil {
+		soc.deliverFrame(source, *f.keyboard, keyboard)
+	}
+
+	if pointer != nil && f.pointer != nil {
+		soc.deliverFrame(source, *f.pointer, pointer)
+	}
+}
+
+// deliverFrame from the source to the target if the conflict policy allows it
+func (soc *Socket) deliverFrame(source, target uuid.UUID, frame *events.InputFrame) {
+	if soc.mayDrive(source, target) {
+		soc.sendFrame(source, target, frame)
+		return
+	}
+
+	// the source would otherwise be left with its devices grabbed and nowhere to send its input
+	if _, ok := soc.focus[source]; ok {
+		Logf("server", "%s is held by another source, releasing %s", target, source)
+		soc.audit.Record(soc.targetEntry(audit.EventFocusDenied, source, target))
+		soc.releaseSource(source)
+	}
+}
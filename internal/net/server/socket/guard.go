@@ -0,0 +1,230 @@
+package socket
+
+import (
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/config"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// deny list entry that applies to every peer
+const denyAllPeers = "*"
+
+// guardKey identifies a key that has been held back from a target peer
+type guardKey struct {
+	source uuid.UUID
+	target uuid.UUID
+	code   uint16
+}
+
+// chordGuard stops denied key chords from reaching their target peers
+//
+// it is stateful, the keys held on every source peer are tracked so that a chord can be spotted
+// when its last key goes down, that key is held back along with its repeats and release and the
+// rest of the chord is released on the target so that nothing is left stuck down
+type chordGuard struct {
+	// denied chords keyed by target hostname
+	deny map[string][][]uint16
+	// keys held on each source peer
+	held map[uuid.UUID]*device.ChordTracker
+	// keys held back from a target, dropped until the source releases them
+	blocked map[guardKey]bool
+}
+
+// newChordGuard parses the deny lists from the config
+// bad chords are logged and skipped
+func newChordGuard(lists []config.ChordDenyList) chordGuard {
+	guard := chordGuard{
+		deny:    make(map[string][][]uint16),
+		held:    make(map[uuid.UUID]*device.ChordTracker),
+		blocked: make(map[guardKey]bool),
+	}
+
+	for _, list := range lists {
+		for _, name := range list.Chords {
+			chord, err := device.ParseChord(name)
+			if err != nil {
+				Logf("server", "deny chord %s for %s ignored: %s", name, list.Peer, err)
+				continue
+			}
+
+			guard.deny[list.Peer] = append(guard.deny[list.Peer], device.ChordVariants(chord)...)
+		}
+	}
+
+	return guard
+}
+
+// trackKeys held on the source peer
+// this must be done for every frame that a source sends before it is split up and routed
+func (soc *Socket) trackKeys(source uuid.UUID, frame *events.InputFrame) {
+	tracker, ok := soc.guard.held[source]
+	if !ok {
+		tracker = device.NewChordTracker()
+		soc.guard.held[source] = tracker
+	}
+
+	for i := range frame.Events {
+		tracker.Update(&frame.Events[i])
+	}
+}
+
+// filterChords removes the key events that would complete a denied chord on the target
+// nil is returned if nothing is left worth sending
+func (soc *Socket) filterChords(source, target uuid.UUID, frame *events.InputFrame) *events.InputFrame {
+	chords := soc.deniedChords(target)
+	if len(chords) == 0 && len(soc.guard.blocked) == 0 {
+		return frame
+	}
+
+	var (
+		filtered = &events.InputFrame{Target: frame.Target}
+		changed  bool
+		// if there is anything left in the frame besides the syn report
+		kept bool
+	)
+
+	for _, ev := range frame.Events {
+		if !device.IsKeyEvent(&ev) {
+			filtered.Events = append(filtered.Events, ev)
+			kept = kept || !device.IsSynReport(&ev)
+			continue
+		}
+
+		key := guardKey{source, target, ev.Code}
+
+		if soc.guard.blocked[key] {
+			// repeats and the release of a held back key never reach the target
+			if ev.Value == 0 {
+				delete(soc.guard.blocked, key)
+			}
+
+			changed = true
+			continue
+		}
+
+		if ev.Value == 1 {
+			if chord := soc.completedChord(source, ev.Code, chords); chord != nil {
+				releases := soc.blockChord(source, target, chord, ev)
+				filtered.Events = append(filtered.Events, releases...)
+				changed = true
+				kept = kept || len(releases) > 0
+				continue
+			}
+		}
+
+		filtered.Events = append(filtered.Events, ev)
+		kept = true
+	}
+
+	if !changed {
+		return frame
+	}
+
+	if !kept {
+		return nil
+	}
+
+	return filtered
+}
+
+// deniedChords for the target peer
+func (soc *Socket) deniedChords(target uuid.UUID) [][]uint16 {
+	if len(soc.guard.deny) == 0 {
+		return nil
+	}
+
+	chords := soc.guard.deny[denyAllPeers]
+	if hostname := soc.hostnameOf(target); hostname != "" {
+		chords = append(chords[:len(chords):len(chords)], soc.guard.deny[hostname]...)
+	}
+
+	return chords
+}
+
+// completedChord finds the denied chord, if any, that pressing the key completes
+func (soc *Socket) completedChord(source uuid.UUID, code uint16, chords [][]uint16) []uint16 {
+	tracker, ok := soc.guard.held[source]
+	if !ok {
+		return nil
+	}
+
+	for _, chord := range chords {
+		for _, key := range chord {
+			if key == code && tracker.Contains(chord) {
+				return chord
+			}
+		}
+	}
+
+	return nil
+}
+
+// deniedMacroChord finds the first denied chord that playing the macro steps on the target would press
+// macros are played back by the target itself so they cant be filtered as they go
+func (soc *Socket) deniedMacroChord(target uuid.UUID, steps []events.MacroStep) []uint16 {
+	chords := soc.deniedChords(target)
+	if len(chords) == 0 {
+		return nil
+	}
+
+	tracker := device.NewChordTracker()
+	for _, step := range steps {
+		for i := range step.Frame.Events {
+			ev := &step.Frame.Events[i]
+			if !tracker.Update(ev) {
+				continue
+			}
+
+			for _, chord := range chords {
+				if tracker.Contains(chord) {
+					return chord
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// blockChord holds back the key that completed the chord and releases the rest of it on the target
+// the released keys are held back too until the source lets go of them
+func (soc *Socket) blockChord(source, target uuid.UUID, chord []uint16, press events.InputEvent) []events.InputEvent {
+	Logf("server", "blocked %s on %s", device.ChordString(chord), target)
+
+	entry := soc.targetEntry(audit.EventChordBlocked, source, target)
+	entry.Detail = device.ChordString(chord)
+	soc.audit.Record(entry)
+
+	soc.guard.blocked[guardKey{source, target, press.Code}] = true
+
+	var releases []events.InputEvent
+	for _, code := range chord {
+		key := guardKey{source, target, code}
+		if code == press.Code || soc.guard.blocked[key] {
+			continue
+		}
+
+		release := press
+		release.Code = code
+		release.Value = 0
+
+		releases = append(releases, release)
+		soc.guard.blocked[key] = true
+	}
+
+	return releases
+}
+
+// forgetGuardState for a disconnected peer
+func (soc *Socket) forgetGuardState(id uuid.UUID) {
+	delete(soc.guard.held, id)
+
+	for key := range soc.guard.blocked {
+		if key.source == id || key.target == id {
+			delete(soc.guard.blocked, key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package socket
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/device"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// handleMacroRecorded stores a macro recorded on a peer and syncs the new bindings to all peers
+// the macro is bound to the KEY_MACRO<n> key matching its slot if there is one
+func (soc *Socket) handleMacroRecorded(data []byte) {
+	var msg events.MacroRecorded
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal macro recorded")
+		return
+	}
+
+	macro, slot, err := soc.macros.Add(msg.Steps)
+	if err != nil {
+		Logf("server", "failed to store macro: %s", err)
+	}
+
+	if chord, err := device.ParseChord(fmt.Sprintf("KEY_MACRO%d", slot)); err == nil {
+		if err := soc.macros.Bind(macro.Name, chord, ""); err != nil {
+			Logf("server", "failed to bind macro: %s", err)
+		}
+	}
+
+	Logf("server", "macro recorded: %s (%d steps)", macro.Name, len(msg.Steps))
+	soc.broadcast(soc.macros.Bindings())
+}
+
+// handlePlayMacro sends the macro steps to the peer it should be played on
+//
+// macros with a target are played on that peer, otherwise they are played wherever the peer that
+// triggered the macro has keyboard focus
+func (soc *Socket) handlePlayMacro(conUUID *uuid.UUID, data []byte) {
+	var msg events.PlayMacro
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		Log("server", "failed to unmarshal play macro")
+		return
+	}
+
+	macro, ok := soc.macros.Find(msg.Name)
+	if !ok {
+		Logf("server", "unknown macro: %s", msg.Name)
+		return
+	}
+
+	target := soc.keyboardTarget(*conUUID)
+	if macro.Target != "" {
+		peer := soc.screenManager.FindPeerByHostname(macro.Target)
+		if peer == nil {
+			Logf("server", "macro target not connected: %s", macro.Target)
+			return
+		}
+
+		target = peer.UUID
+	}
+
+	client, ok := soc.clients[target]
+	if !ok {
+		return
+	}
+
+	if chord := soc.deniedMacroChord(target, macro.Steps); chord != nil {
+		Logf("server", "macro %s not played on %s: contains %s", macro.Name, target, device.ChordString(chord))
+
+		entry := soc.targetEntry(audit.EventChordBlocked, *conUUID, target)
+		entry.Detail = fmt.Sprintf("macro %s: %s", macro.Name, device.ChordString(chord))
+		soc.audit.Record(entry)
+
+		return
+	}
+
+	playback := events.MacroPlayback{
+		Name:  macro.Name,
+		Steps: macro.Steps,
+	}
+
+	data, err := playback.Marshal()
+	if err != nil {
+		Logf("server", "failed to marshal macro: %s", err)
+		return
+	}
+
+	Logf("server", "play macro %s on %s", macro.Name, target)
+	soc.queueSend(client, data)
+}
+
+// sendMacros gives a newly connected peer the current macro bindings
+func (soc *Socket) sendMacros(con *ConnectionWrapper) {
+	data, err := soc.macros.Bindings().Marshal()
+	if err != nil {
+		return
+	}
+
+	soc.queueSend(con, data)
+}
+
+// Macros stored for the cluster
+func (soc *Socket) Macros() []events.Macro {
+	return soc.macros.All()
+}
+
+// BindMacro to a new chord and target peer then sync the change to all peers
+func (soc *Socket) BindMacro(name string, chord []uint16, target string) error {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	if err := soc.macros.Bind(name, chord, target); err != nil {
+		return err
+	}
+
+	soc.broadcast(soc.macros.Bindings())
+	return nil
+}
+
+// RemoveMacro from the cluster and sync the change to all peers
+func (soc *Socket) RemoveMacro(name string) error {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	if err := soc.macros.Remove(name); err != nil {
+		return err
+	}
+
+	soc.broadcast(soc.macros.Bindings())
+	return nil
+}
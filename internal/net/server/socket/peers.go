@@ -0,0 +1,134 @@
+package socket
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/trust"
+)
+
+var (
+	ErrPeerNotFound = errors.New("peer not found")
+	ErrServerPeer   = errors.New("the server peer cannot be revoked")
+)
+
+// Peer statuses reported to the ui and api
+const (
+	PeerStatusPending      = "pending"
+	PeerStatusOnline       = "online"
+	PeerStatusReconnecting = "reconnecting"
+	PeerStatusOffline      = "offline"
+)
+
+// pendingPeer has connected and authenticated but is waiting on an operator to approve it
+type pendingPeer struct {
+	con  *ConnectionWrapper
+	info events.ClientConnect
+}
+
+// PeerState describes a peer known to the server
+type PeerState struct {
+	UUID     uuid.UUID `json:"uuid"`
+	Hostname string    `json:"hostname"`
+	Status   string    `json:"status"`
+}
+
+// Peers gives every pending and trusted peer along with its status
+func (soc *Socket) Peers() []PeerState {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	var peers []PeerState
+	for id, pending := range soc.pending {
+		peers = append(peers, PeerState{
+			UUID:     id,
+			Hostname: pending.info.Hostname,
+			Status:   PeerStatusPending,
+		})
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Hostname < peers[j].Hostname
+	})
+
+	for _, peer := range soc.trusted.All() {
+		status := PeerStatusOffline
+		if _, ok := soc.clients[peer.UUID]; ok {
+			status = PeerStatusOnline
+		} else if _, ok := soc.detached[peer.UUID]; ok {
+			status = PeerStatusReconnecting
+		}
+
+		peers = append(peers, PeerState{
+			UUID:     peer.UUID,
+			Hostname: peer.Hostname,
+			Status:   status,
+		})
+	}
+
+	return peers
+}
+
+// ApprovePeer trusts a pending peer by its identity and lets it join the cluster
+func (soc *Socket) ApprovePeer(id uuid.UUID) error {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	pending, ok := soc.pending[id]
+	if !ok {
+		return ErrPeerNotFound
+	}
+
+	if err := soc.trusted.Approve(id, pending.info.Hostname, pending.info.PublicKey); err != nil {
+		return err
+	}
+
+	Logf("server", "peer %s (%s) approved", pending.info.Hostname, id)
+	soc.audit.Record(soc.peerEntry(audit.EventApprove, id))
+	delete(soc.pending, id)
+	soc.addPeer(pending.con, &pending.info)
+
+	return nil
+}
+
+// RevokePeer removes a peers trust, disconnecting it if it is connected
+// revoking a pending peer rejects it
+func (soc *Socket) RevokePeer(id uuid.UUID) error {
+	if id == soc.serverUUID {
+		return ErrServerPeer
+	}
+
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	if pending, ok := soc.pending[id]; ok {
+		Logf("server", "peer %s (%s) rejected", pending.info.Hostname, id)
+		soc.audit.Record(soc.peerEntry(audit.EventReject, id))
+		delete(soc.pending, id)
+		pending.con.Close()
+		return nil
+	}
+
+	if err := soc.trusted.Revoke(id); errors.Is(err, trust.ErrNotFound) {
+		return ErrPeerNotFound
+	} else if err != nil {
+		return err
+	}
+
+	Logf("server", "peer %s revoked", id)
+	soc.audit.Record(soc.peerEntry(audit.EventRevoke, id))
+
+	con, ok := soc.clients[id]
+	soc.removePeer(id)
+	soc.screenManager.ForgetPeer(id)
+
+	if ok {
+		con.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package socket
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/audit"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// detachPeer that lost its connection
+// its place in the layout and the focus to and from it are held for the grace period so that a peer
+// that comes straight back picks up where it left off, anything tied to the connection itself is
+// dropped straight away
+func (soc *Socket) detachPeer(id uuid.UUID) {
+	if _, ok := soc.clients[id]; !ok {
+		return
+	}
+
+	delete(soc.clients, id)
+	soc.forgetMirrors(id)
+	soc.forgetGuardState(id)
+	soc.forgetDatagram(id)
+	soc.forgetDirectPeer(id)
+	soc.updateDirectRoutes()
+
+	grace := time.Duration(soc.appCtx.Config.Server.WsCloseGracePeriod) * time.Second
+	Logf("server", "peer %s disconnected, holding its place for %s", id, grace)
+
+	soc.detached[id] = time.AfterFunc(grace, func() {
+		soc.mux.Lock()
+		defer soc.unlock()
+
+		soc.expirePeer(id)
+	})
+}
+
+// expirePeer that did not come back within the grace period
+func (soc *Socket) expirePeer(id uuid.UUID) {
+	if _, ok := soc.detached[id]; !ok {
+		return
+	}
+
+	Logf("server", "peer %s did not reconnect, removing it", id)
+	soc.audit.Record(soc.peerEntry(audit.EventExpire, id))
+	soc.removePeer(id)
+}
+
+// resumePeer that reconnected within the grace period
+// returns false if the peer was not being held
+func (soc *Socket) resumePeer(id uuid.UUID) bool {
+	timer, ok := soc.detached[id]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(soc.detached, id)
+
+	Logf("server", "peer %s resumed its session", id)
+	soc.audit.Record(soc.peerEntry(audit.EventResume, id))
+
+	return true
+}
+
+// sendSessionResumed gives a resumed peer the focus it had so that it can grab its devices again
+func (soc *Socket) sendSessionResumed(id uuid.UUID) {
+	var msg events.SessionResumed
+
+	if f, ok := soc.focus[id]; ok {
+		if f.pointer != nil && *f.pointer != id {
+			msg.Pointer = *f.pointer
+		}
+
+		if f.keyboard != nil && *f.keyboard != id {
+			msg.Keyboard = *f.keyboard
+		}
+	}
+
+	soc.sendTo(id, &msg)
+
+	if soc.broadcasting.state.Active {
+		soc.sendTo(id, &soc.broadcasting.state)
+	}
+}
@@ -2,25 +2,48 @@ package socket
 
 import (
 	"context"
+	"crypto/ed25519"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/indeedhat/harmony/internal/audit"
 	"github.com/indeedhat/harmony/internal/common"
+	"github.com/indeedhat/harmony/internal/device"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/macro"
+	"github.com/indeedhat/harmony/internal/net/udp"
 	"github.com/indeedhat/harmony/internal/screens"
+	"github.com/indeedhat/harmony/internal/trust"
 )
 
+// how long a connection has to answer a probe before it is considered dead
+const probeTimeout = 2 * time.Second
+
+// number of messages that can be waiting to go out to a peer, one that falls further behind is dropped
+const sendBuffer = 256
+
 type ConnectionWrapper struct {
-	ctx   context.Context
-	Soc   *websocket.Conn
-	Input chan []byte
+	ctx       context.Context
+	Soc       *websocket.Conn
+	Input     chan []byte
+	writeWait time.Duration
+	dropOnce  sync.Once
+
+	// liveness of the connection, a peer that reconnects may only take over from a dead one
+	probeSent time.Time
+	lastPong  time.Time
+	liveMux   sync.Mutex
 }
 
-func NewConn(ctx context.Context, ws *websocket.Conn) *ConnectionWrapper {
+func NewConn(ctx context.Context, ws *websocket.Conn, writeWait time.Duration) *ConnectionWrapper {
 	con := &ConnectionWrapper{
-		ctx:   ctx,
-		Soc:   ws,
-		Input: make(chan []byte),
+		ctx:       ctx,
+		Soc:       ws,
+		Input:     make(chan []byte, sendBuffer),
+		writeWait: writeWait,
 	}
 
 	go con.consumeIncommingMessages()
@@ -32,35 +55,165 @@ func (con *ConnectionWrapper) Close() error {
 	return con.Soc.Close()
 }
 
+// pong records the peer answering a ping
+func (con *ConnectionWrapper) pong() {
+	con.liveMux.Lock()
+	defer con.liveMux.Unlock()
+
+	con.lastPong = time.Now()
+}
+
+// unresponsive reports if the connection has failed to answer a probe in time
+// if there is no probe outstanding one is sent so that a later check can tell
+func (con *ConnectionWrapper) unresponsive() bool {
+	con.liveMux.Lock()
+	defer con.liveMux.Unlock()
+
+	if !con.probeSent.IsZero() && con.lastPong.Before(con.probeSent) {
+		return time.Since(con.probeSent) > probeTimeout
+	}
+
+	con.probeSent = time.Now()
+	go con.Soc.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(probeTimeout))
+
+	return false
+}
+
+// send data to the peer without waiting on it
+// a peer that has fallen too far behind to take it is disconnected, it can resume once it reconnects
+func (con *ConnectionWrapper) send(data []byte) {
+	select {
+	case con.Input <- data:
+	default:
+		con.drop()
+	}
+}
+
+// drop the connection, the reader sees it close and cleans up after the peer
+func (con *ConnectionWrapper) drop() {
+	con.dropOnce.Do(func() {
+		Logf("server", "peer %s fell behind, dropping connection", con.Soc.RemoteAddr())
+		con.Close()
+	})
+}
+
 func (con *ConnectionWrapper) consumeIncommingMessages() {
 	for {
 		select {
 		case <-con.ctx.Done():
 			return
 		case data := <-con.Input:
-			con.Soc.WriteMessage(websocket.BinaryMessage, data)
-
+			con.Soc.SetWriteDeadline(time.Now().Add(con.writeWait))
+			if err := con.Soc.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				con.drop()
+				return
+			}
 		}
 	}
 }
 
+// outgoing message queued while the socket lock is held
+type outgoing struct {
+	con  *ConnectionWrapper
+	data []byte
+}
+
 type Socket struct {
-	appCtx        *common.Context
-	clients       map[uuid.UUID]*ConnectionWrapper
-	activeClient  *uuid.UUID
-	serverUUID    uuid.UUID
+	appCtx  *common.Context
+	clients map[uuid.UUID]*ConnectionWrapper
+	// peers that lost their connection, their place is held until the timer runs out
+	detached map[uuid.UUID]*time.Timer
+	// peers that have connected but not yet been approved, they recieve no zones or input
+	pending map[uuid.UUID]*pendingPeer
+	// peers that have been approved to join the cluster
+	trusted *trust.Store
+	// append only record of connections, focus changes and security events
+	audit *audit.Log
+	// peers that keyboard and pointer input from each source peer are routed to
+	focus map[uuid.UUID]*focus
+	// peers that keyboard input is being fanned out to
+	broadcasting broadcastInput
+	serverUUID   uuid.UUID
+	// identity key of the peer running alongside the server, nil for a dedicated coordinator
+	serverKey ed25519.PublicKey
+	// devices being mirrored from one peer to another
+	mirrors       map[mirrorKey]*mirror
 	screenManager *screens.ScreenManager
+	// macros shared between all peers in the cluster
+	macros *macro.Store
+	// keys that are routed to the media host rather than the focused peer
+	mediaKeys device.KeySet
+	// chords that are never forwarded to certain peers
+	guard chordGuard
+	// listener for the input data channels, nil if udp is disabled
+	udp *udp.Listener
+	// data channels open to each peer
+	datagrams map[uuid.UUID]*udp.Channel
+	// input paths that go straight between peers rather than through the server
+	direct directRoutes
+	// messages for the peers are held here while the lock is held and sent once it is released
+	outbox []outgoing
+	// guards the client state as it is shared between the websocket connections and the api
+	mux sync.Mutex
+}
+
+// queueSend data to a peer once the lock is released
+// the lock must be held
+func (soc *Socket) queueSend(con *ConnectionWrapper, data []byte) {
+	if con == nil {
+		return
+	}
+
+	soc.outbox = append(soc.outbox, outgoing{con: con, data: data})
+}
+
+// unlock the socket then send everything that was queued while it was held
+func (soc *Socket) unlock() {
+	outbox := soc.outbox
+	soc.outbox = nil
+	soc.mux.Unlock()
+
+	for _, msg := range outbox {
+		msg.con.send(msg.data)
+	}
 }
 
 // New UI controller
-func New(ctx *common.Context, serverUUID uuid.UUID, router *gin.Engine, screenManager *screens.ScreenManager) *Socket {
+func New(
+	ctx *common.Context,
+	serverUUID uuid.UUID,
+	serverKey ed25519.PublicKey,
+	router *gin.Engine,
+	screenManager *screens.ScreenManager,
+	macros *macro.Store,
+	trusted *trust.Store,
+	auditLog *audit.Log,
+) *Socket {
 	socket := &Socket{
 		appCtx:        ctx,
 		clients:       make(map[uuid.UUID]*ConnectionWrapper),
+		detached:      make(map[uuid.UUID]*time.Timer),
+		pending:       make(map[uuid.UUID]*pendingPeer),
+		trusted:       trusted,
+		audit:         auditLog,
+		focus:         make(map[uuid.UUID]*focus),
+		mirrors:       make(map[mirrorKey]*mirror),
 		serverUUID:    serverUUID,
+		serverKey:     serverKey,
 		screenManager: screenManager,
+		macros:        macros,
+		guard:         newChordGuard(ctx.Config.Server.DenyChords),
+		datagrams:     make(map[uuid.UUID]*udp.Channel),
+		direct:        newDirectRoutes(),
+	}
+
+	mediaKeys, err := device.ParseKeySet(ctx.Config.LocalKeys.MediaKeys)
+	if err != nil {
+		Logf("server", "media keys disabled: %s", err)
 	}
 
+	socket.mediaKeys = mediaKeys
+	socket.listenUdp()
 	socket.routes(router)
 
 	return socket
@@ -0,0 +1,44 @@
+package socket
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// TypeText sends text to be typed out on a peers local keyboard layout
+// the text goes to the named peer, or if none is given wherever the default source peer has keyboard
+// focus
+func (soc *Socket) TypeText(hostname string, msg *events.TypeText) error {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	var target uuid.UUID
+	if hostname != "" {
+		peer := soc.screenManager.FindPeerByHostname(hostname)
+		if peer == nil {
+			return errors.New("target peer not connected")
+		}
+
+		target = peer.UUID
+	} else if source, ok := soc.defaultSource(); ok {
+		target = soc.keyboardTarget(source)
+	}
+
+	client, ok := soc.clients[target]
+	if !ok {
+		return errors.New("no peer available to type text")
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	Logf("server", "type text on %s", target)
+	soc.queueSend(client, data)
+
+	return nil
+}
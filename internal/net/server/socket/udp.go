@@ -0,0 +1,131 @@
+package socket
+
+import (
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+	"github.com/indeedhat/harmony/internal/net/udp"
+)
+
+// listenUdp for the input data channels if they are enabled
+func (soc *Socket) listenUdp() {
+	cfg := soc.appCtx.Config.Transport
+	if !cfg.Udp {
+		return
+	}
+
+	port := cfg.UdpPort
+	if port == 0 {
+		port = soc.appCtx.Config.Server.Port + 1
+	}
+
+	listener, err := udp.Listen(port, cfg.LossPercent)
+	if err != nil {
+		Logf("server", "udp data channel disabled: %s", err)
+		return
+	}
+
+	Logf("server", "listening for udp data channels on %d", port)
+	soc.udp = listener
+}
+
+// offerDatagram channel to a peer that supports it
+// until the peer opens its end frames keep going over the websocket
+func (soc *Socket) offerDatagram(id uuid.UUID, con *ConnectionWrapper) {
+	if soc.udp == nil {
+		return
+	}
+
+	ch, offer, err := soc.udp.Offer(
+		func(data []byte) { soc.receiveDatagram(id, data) },
+		func() { soc.datagramFailed(id) },
+	)
+	if err != nil {
+		Logf("server", "failed to offer udp channel: %s", err)
+		return
+	}
+
+	data, err := offer.Marshal()
+	if err != nil {
+		soc.udp.Remove(ch)
+		return
+	}
+
+	soc.datagrams[id] = ch
+	soc.queueSend(con, data)
+}
+
+// receiveDatagram handles input sent by a peer over its data channel
+// only input frames are accepted, everything else has to go over the websocket
+func (soc *Socket) receiveDatagram(id uuid.UUID, data []byte) {
+	if len(data) < 2 || events.MsgType(data[0]) != events.MsgTypeInputFrame {
+		return
+	}
+
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	if _, ok := soc.clients[id]; !ok {
+		return
+	}
+
+	soc.handleInputFrame(&id, data)
+}
+
+// datagramFailed is called once a data channel gives up on retransmitting
+func (soc *Socket) datagramFailed(id uuid.UUID) {
+	soc.mux.Lock()
+	defer soc.unlock()
+
+	soc.dropDatagram(id)
+}
+
+// sendDatagram sends a frame over the peers data channel
+// false is returned if the frame should be sent over the websocket instead
+func (soc *Socket) sendDatagram(id uuid.UUID, data []byte, reliable bool) bool {
+	ch, ok := soc.datagrams[id]
+	if !ok {
+		return false
+	}
+
+	if ch.Send(data, reliable) {
+		return true
+	}
+
+	if ch.Failed() {
+		soc.dropDatagram(id)
+	}
+
+	return false
+}
+
+// dropDatagram channel for a peer and fall back to the websocket
+// anything that was never acked is resent over the websocket so that no key events are lost
+func (soc *Socket) dropDatagram(id uuid.UUID) {
+	ch, ok := soc.datagrams[id]
+	if !ok {
+		return
+	}
+
+	delete(soc.datagrams, id)
+	soc.udp.Remove(ch)
+
+	Logf("server", "udp channel to %s failed, falling back to the websocket", id)
+
+	client, ok := soc.clients[id]
+	if !ok {
+		return
+	}
+
+	for _, data := range ch.Pending() {
+		soc.queueSend(client, data)
+	}
+}
+
+// forgetDatagram channel for a peer that has gone away
+func (soc *Socket) forgetDatagram(id uuid.UUID) {
+	if ch, ok := soc.datagrams[id]; ok {
+		delete(soc.datagrams, id)
+		soc.udp.Remove(ch)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/indeedhat/harmony/internal/audit"
 	"github.com/indeedhat/harmony/internal/common"
 	"github.com/indeedhat/harmony/internal/config"
 	"github.com/indeedhat/harmony/internal/events"
@@ -30,7 +31,8 @@ func (soc *Socket) Ws() gin.HandlerFunc {
 		}
 
 		done := make(chan struct{})
-		go soc.readFromSocket(NewConn(ctx, ws), done)
+		writeWait := time.Duration(soc.appCtx.Config.Server.WsWriteWaitSecond) * time.Second
+		go soc.readFromSocket(NewConn(ctx, ws, writeWait), done)
 		go ping(soc.appCtx, ws)
 
 		<-done
@@ -48,7 +50,7 @@ func (soc *Socket) broadcast(msg events.WsMessage) {
 	}
 
 	for _, ws := range soc.clients {
-		ws.Input <- data
+		soc.queueSend(ws, data)
 	}
 }
 
@@ -60,10 +62,20 @@ func (soc *Socket) readFromSocket(con *ConnectionWrapper, done chan struct{}) {
 	con.Soc.SetReadDeadline(time.Now().Add(config.PongWait))
 	con.Soc.SetPongHandler(func(string) error {
 		con.Soc.SetReadDeadline(time.Now().Add(config.PongWait))
+		con.pong()
 		return nil
 	})
 
-	var conUUID *uuid.UUID
+	var (
+		conUUID *uuid.UUID
+		authed  bool
+	)
+
+	nonce, err := soc.sendChallenge(con)
+	if err != nil {
+		Logf("server", "failed to send auth challenge: %s", err)
+		return
+	}
 
 	for {
 		messageType, data, err := con.Soc.ReadMessage()
@@ -71,104 +83,270 @@ func (soc *Socket) readFromSocket(con *ConnectionWrapper, done chan struct{}) {
 			break
 		}
 
-		if messageType != websocket.BinaryMessage ||
-			(conUUID == nil && data[0] != byte(events.MsgTypeConnect)) {
+		if messageType != websocket.BinaryMessage || len(data) < 2 {
+			continue
+		}
+
+		// nothing else is accepted until the peer has proven it knows the cluster secret
+		if !authed {
+			if !soc.authenticate(con, nonce, data) {
+				Logf("server", "rejected peer %s: authentication failed", con.Soc.RemoteAddr())
+				soc.audit.Record(audit.Entry{
+					Event:   audit.EventHandshakeRejected,
+					Address: con.Soc.RemoteAddr().String(),
+					Detail:  "authentication failed",
+				})
+				con.Close()
+				break
+			}
+
+			authed = true
+			continue
+		}
+
+		if conUUID == nil && data[0] != byte(events.MsgTypeConnect) {
+			continue
+		}
+
+		soc.mux.Lock()
 
+		// pending peers are ignored until an operator approves them
+		if conUUID != nil && soc.pending[*conUUID] != nil {
+			soc.unlock()
 			continue
 		}
 
 		// handle events
 		switch events.MsgType(data[0]) {
 		case events.MsgTypeConnect:
-			conUUID = soc.handleConnect(con, data)
-			defer soc.handleDisconnect(conUUID)
+			conUUID = soc.handleConnect(con, nonce, data)
+			defer soc.handleDisconnect(con, conUUID)
 
 		case events.MsgTypeInputEvent:
-			soc.handleInputEvent(data)
+			soc.handleInputEvent(conUUID, data)
+
+		case events.MsgTypeInputFrame:
+			soc.handleInputFrame(conUUID, data)
 
 		case events.MsgTypeChangeFoucs:
 			soc.handleChangeFocus(conUUID, data)
 
 		case events.MsgTypeReleaseFouces:
-			soc.handleReleaseFocus()
+			soc.handleReleaseFocus(conUUID)
+
+		case events.MsgTypeMoveKeyboardFocus:
+			soc.handleMoveKeyboardFocus(conUUID, data)
+
+		case events.MsgTypeToggleBroadcast:
+			soc.handleToggleBroadcast(conUUID)
+
+		case events.MsgTypeDeviceAttached:
+			soc.handleDeviceAttached(conUUID, data)
+
+		case events.MsgTypeDeviceDetached:
+			soc.handleDeviceDetached(conUUID, data)
+
+		case events.MsgTypeDeviceInput:
+			soc.handleDeviceInput(conUUID, data)
+
+		case events.MsgTypeMacroRecorded:
+			soc.handleMacroRecorded(data)
+
+		case events.MsgTypePlayMacro:
+			soc.handlePlayMacro(conUUID, data)
+
+		case events.MsgTypeDirectRevoke:
+			soc.handleDirectRevoke(conUUID, data)
 
 		default:
 			Logf("server", "unknown message type: %s", data[0])
 		}
+
+		soc.unlock()
 	}
 }
 
 // handleDisconnect cleans up the peer data on connection close
-func (soc *Socket) handleDisconnect(conUUID *uuid.UUID) {
+// the peer may have already reconnected on a new connection in which case there is nothing to do
+func (soc *Socket) handleDisconnect(con *ConnectionWrapper, conUUID *uuid.UUID) {
 	if conUUID == nil {
 		return
 	}
 
-	delete(soc.clients, *conUUID)
+	soc.mux.Lock()
+	defer soc.unlock()
 
-	if soc.activeClient != nil && *soc.activeClient == *conUUID {
-		soc.activeClient = nil
-		soc.broadcast(&events.ReleaseFocus{})
+	if pending, ok := soc.pending[*conUUID]; ok {
+		if pending.con == con {
+			soc.audit.Record(soc.disconnectEntry(con, *conUUID))
+			delete(soc.pending, *conUUID)
+		}
+
+		return
 	}
 
-	zones := soc.screenManager.RemovePeer(*conUUID)
+	if soc.clients[*conUUID] != con {
+		return
+	}
+
+	soc.audit.Record(soc.disconnectEntry(con, *conUUID))
+	soc.detachPeer(*conUUID)
+}
+
+// removePeer drops a peer from the cluster and cleans up any state that references it
+func (soc *Socket) removePeer(conUUID uuid.UUID) {
+	_, connected := soc.clients[conUUID]
+	timer, detached := soc.detached[conUUID]
+	if !connected && !detached {
+		return
+	}
+
+	if detached {
+		timer.Stop()
+		delete(soc.detached, conUUID)
+	}
+
+	delete(soc.clients, conUUID)
+	soc.forgetMirrors(conUUID)
+	soc.forgetBroadcastPeer(conUUID)
+	soc.forgetGuardState(conUUID)
+	soc.forgetDatagram(conUUID)
+	soc.forgetDirectPeer(conUUID)
+
+	// sources controlling the disconnected peer take back their devices
+	delete(soc.focus, conUUID)
+	for source, f := range soc.focus {
+		if f.has(conUUID) {
+			soc.releaseSource(source)
+		}
+	}
+
+	zones := soc.screenManager.RemovePeer(conUUID)
 	soc.distributeTransitionZones(zones)
+	soc.updateDirectRoutes()
 }
 
-// handleReleaseFocus broadcasts the event out to all clients on force release recieved
-func (soc *Socket) handleReleaseFocus() {
+// handleReleaseFocus hands the devices back to the source that asked for an emergency release
+func (soc *Socket) handleReleaseFocus(conUUID *uuid.UUID) {
 	Log("server", "release focus")
-	soc.activeClient = nil
-	soc.broadcast(&events.ReleaseFocus{})
+	soc.audit.Record(soc.peerEntry(audit.EventEmergencyRelease, *conUUID))
+
+	// only the requesting source lets go, any other sources keep their focus
+	if soc.broadcasting.state.Active && soc.broadcasting.state.Source == *conUUID {
+		soc.stopBroadcast()
+	}
+
+	soc.releaseSource(*conUUID)
+}
+
+// handleInputEvent forwards a single hid event from a peer that does not send frames
+func (soc *Socket) handleInputEvent(conUUID *uuid.UUID, data []byte) {
+	var msg events.InputEvent
+	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
+		log.Print("ws: failed to unmarshal message")
+		return
+	}
+
+	soc.forwardInputFrame(*conUUID, &events.InputFrame{Events: []events.InputEvent{msg}})
 }
 
-// handleChangeFocus lets the appropriate client know it has focus
-func (soc *Socket) handleChangeFocus(conUUID *uuid.UUID, data []byte) {
-	Log("server", "change focus")
-	var msg events.ChangeFocus
+// handleInputFrame forwards a frame of hid events to the appropriate peer
+func (soc *Socket) handleInputFrame(conUUID *uuid.UUID, data []byte) {
+	var msg events.InputFrame
 	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
 		log.Print("ws: failed to unmarshal message")
+		return
 	}
 
-	if _, ok := soc.clients[msg.UUID]; !ok {
+	if msg.Target != "" {
+		soc.trackKeys(*conUUID, &msg)
+		soc.forwardPinnedFrame(*conUUID, &msg)
 		return
 	}
 
-	soc.activeClient = &msg.UUID
+	soc.forwardInputFrame(*conUUID, &msg)
+}
 
-	recMessage := events.FocusRecieved{}
-	data, err := recMessage.Marshal()
-	if err == nil {
-		soc.clients[msg.UUID].Input <- data
+// forwardPinnedFrame to the peer that the source device is pinned to, regardless of focus
+func (soc *Socket) forwardPinnedFrame(source uuid.UUID, frame *events.InputFrame) {
+	peer := soc.screenManager.FindPeerByHostname(frame.Target)
+	if peer == nil {
+		return
 	}
+
+	soc.sendFrame(source, peer.UUID, frame)
 }
 
-// handleInputEvent forwards thi hid event to the appropriate peer
-func (soc *Socket) handleInputEvent(data []byte) {
-	if soc.activeClient == nil {
+// forwardInputFrame to the peer the source has focus on
+// media keys are split out and sent to the media host instead, and keyboard events from the source
+// of a broadcast are sent to all of the broadcast peers
+func (soc *Socket) forwardInputFrame(source uuid.UUID, frame *events.InputFrame) {
+	soc.trackKeys(source, frame)
+
+	if host := soc.appCtx.Config.LocalKeys.MediaHost; host != "" {
+		var media *events.InputFrame
+		if media, frame = soc.mediaKeys.Split(frame); media != nil {
+			media.Target = host
+			soc.forwardPinnedFrame(source, media)
+		}
+
+		if frame == nil {
+			return
+		}
+	}
+
+	if soc.broadcasting.state.Active && soc.broadcasting.state.Source == source {
+		if frame = soc.forwardBroadcastFrame(source, frame); frame == nil {
+			return
+		}
+	}
+
+	f, ok := soc.focus[source]
+	if !ok || !f.active() {
 		Log("server", "no active client")
-		// something must have gone wrong to get to here, reset the peers active state
-		soc.handleReleaseFocus()
+		// something must have gone wrong to get to here, reset the sources active state
+		soc.releaseSource(source)
 		return
 	}
 
-	var msg events.InputEvent
-	if err := msgpack.Unmarshal(data[2:], &msg); err != nil {
-		log.Print("ws: failed to unmarshal message")
+	soc.forwardFocusedFrame(source, f, frame)
+}
+
+// sendFrame from the source to a connected peer
+// denied chords are filtered out on the way
+func (soc *Socket) sendFrame(source, id uuid.UUID, frame *events.InputFrame) {
+	client, ok := soc.clients[id]
+	if !ok {
+		// input to a peer that is reconnecting is dropped until it comes back
+		if _, held := soc.detached[id]; !held {
+			Log("server", "bad active client")
+		}
 		return
 	}
 
-	client, ok := soc.clients[*soc.activeClient]
-	if !ok {
-		Log("server", "bad active client")
+	if frame = soc.filterChords(source, id, frame); frame == nil {
+		return
+	}
+
+	data, err := frame.Marshal()
+	if err != nil {
+		Logf("server", "failed to marshal frame: %s", err)
 		return
 	}
 
-	client.Input <- data
+	if soc.sendDatagram(id, data, !frame.IsMotion()) {
+		return
+	}
+
+	soc.queueSend(client, data)
 }
 
 // handleConnect handles a connection event and rebuilds the transition zones
-func (soc *Socket) handleConnect(con *ConnectionWrapper, data []byte) *uuid.UUID {
+//
+// the peer must prove it holds the key for its identity by signing the auth challenge, peers whose key
+// has not been approved wait in pending and a peer claiming a trusted uuid with the wrong key is
+// turned away
+func (soc *Socket) handleConnect(con *ConnectionWrapper, challenge, data []byte) *uuid.UUID {
 	Log("server", "client connect")
 	var msg events.ClientConnect
 
@@ -176,12 +354,86 @@ func (soc *Socket) handleConnect(con *ConnectionWrapper, data []byte) *uuid.UUID
 		return nil
 	}
 
+	entry := audit.Entry{
+		Event:    audit.EventConnect,
+		Peer:     msg.UUID.String(),
+		Hostname: msg.Hostname,
+		Address:  con.Soc.RemoteAddr().String(),
+	}
+
+	if reason := soc.checkIdentity(con, &msg, challenge); reason != "" {
+		Logf("server", "rejected peer %s (%s): %s", msg.Hostname, msg.UUID, reason)
+
+		entry.Event = audit.EventHandshakeRejected
+		entry.Detail = reason
+		soc.audit.Record(entry)
+
+		con.Close()
+		return nil
+	}
+
+	// the peer is only let back in over its existing connection once that connection has gone dead,
+	// until then it has to keep retrying
+	if old, ok := soc.clients[msg.UUID]; ok && old != con && !old.unresponsive() {
+		Logf("server", "rejected peer %s (%s): already connected", msg.Hostname, msg.UUID)
+
+		entry.Event = audit.EventHandshakeRejected
+		entry.Detail = "already connected"
+		soc.audit.Record(entry)
+
+		con.Close()
+		return nil
+	}
+
+	if msg.UUID != soc.serverUUID && !soc.trusted.IsTrusted(msg.UUID, msg.PublicKey) {
+		if _, ok := soc.pending[msg.UUID]; ok {
+			Logf("server", "rejected peer %s (%s): already waiting for approval", msg.Hostname, msg.UUID)
+			con.Close()
+			return nil
+		}
+
+		Logf("server", "peer %s (%s) is waiting for approval", msg.Hostname, msg.UUID)
+		soc.pending[msg.UUID] = &pendingPeer{con: con, info: msg}
+
+		entry.Event = audit.EventPending
+		soc.audit.Record(entry)
+
+		return &msg.UUID
+	}
+
+	soc.audit.Record(entry)
+	soc.addPeer(con, &msg)
+
+	return &msg.UUID
+}
+
+// addPeer to the cluster so that it can recieve zones and input
+// a peer that reconnects within the grace period keeps its place in the layout and its focus
+func (soc *Socket) addPeer(con *ConnectionWrapper, msg *events.ClientConnect) {
+	// the old connection failed to answer its probe but may not have noticed it is dead yet
+	if old, ok := soc.clients[msg.UUID]; ok && old != con {
+		soc.detachPeer(msg.UUID)
+		old.Close()
+	}
+
+	resumed := soc.resumePeer(msg.UUID)
+
 	soc.clients[msg.UUID] = con
+	soc.sendMacros(con)
+
+	if msg.Udp {
+		soc.offerDatagram(msg.UUID, con)
+	}
+
+	soc.registerDirectPeer(con, msg)
+
+	if resumed {
+		soc.sendSessionResumed(msg.UUID)
+		soc.updateDirectRoutes()
+	}
 
 	zones := soc.screenManager.AddPeer(msg.UUID, msg.Displays, msg.Hostname)
 	soc.distributeTransitionZones(zones)
-
-	return &msg.UUID
 }
 
 // distributeTransitionZones to the appropriate peers
@@ -198,7 +450,7 @@ func (soc *Socket) distributeTransitionZones(zones map[uuid.UUID][]screens.Trans
 		data, err := tzMessage.Marshal()
 		if err == nil {
 			Log("server", "sending t zones")
-			con.Input <- data
+			soc.queueSend(con, data)
 		}
 	}
 }
@@ -212,7 +464,7 @@ func ping(ctx *common.Context, ws *websocket.Conn) {
 		select {
 		case <-ticker.C:
 			err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().
-				Add(time.Duration(ctx.Config.Server.WsWriteWaitSecond)+time.Second))
+				Add(time.Duration(ctx.Config.Server.WsWriteWaitSecond)*time.Second))
 
 			if err != nil && errors.Is(err, websocket.ErrCloseSent) {
 				return
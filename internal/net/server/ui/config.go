@@ -11,14 +11,25 @@ import (
 )
 
 // Index controller
+// the page is served without auth so peers are identified by their position rather than their uuid
 func (ui *UI) Index() gin.HandlerFunc {
+	type DisplayTransition struct {
+		// Target is the ID of the group the transition leads to
+		Target int
+		Bounds common.Vector4
+	}
+
 	type DisplayGroup struct {
 		Width       int
 		Height      int
-		UUID        uuid.UUID
+		ID          int
 		Hostname    string
 		Displays    []screens.DisplayBounds
-		Transitions []screens.TransitionZone
+		Transitions []DisplayTransition
+		Broadcast   bool
+		// hostnames of the peers controlling this one
+		Keyboard []string
+		Pointer  []string
 	}
 
 	max := func(a, b int) int {
@@ -30,13 +41,29 @@ func (ui *UI) Index() gin.HandlerFunc {
 
 	return func(ctx *gin.Context) {
 		// TODO: make this actually work from peer display config
-		groups := make([]DisplayGroup, len(ui.screenManager.Peers))
-		zones := ui.screenManager.CalculateTransitionZones()
+		peers := ui.screenManager.Snapshot()
+		groups := make([]DisplayGroup, len(peers))
+		zones := ui.screenManager.TransitionZones()
+		keyboard, pointer := ui.socket.FocusState()
+		broadcast := ui.socket.BroadcastState()
+
+		ids := make(map[uuid.UUID]int)
+		for i, peer := range peers {
+			ids[peer.UUID] = i
+		}
 
-		for i, peer := range ui.screenManager.Peers {
+		for i, peer := range peers {
 			group := DisplayGroup{
-				UUID:     peer.UUID,
+				ID:       i,
 				Hostname: peer.Hostname,
+				Keyboard: ui.hostnames(keyboard[peer.UUID]),
+				Pointer:  ui.hostnames(pointer[peer.UUID]),
+			}
+
+			for _, hostname := range broadcast.Peers {
+				if broadcast.Active && hostname == peer.Hostname {
+					group.Broadcast = true
+				}
 			}
 
 			for _, display := range peer.Displays {
@@ -61,19 +88,36 @@ func (ui *UI) Index() gin.HandlerFunc {
 				zone.Bounds.W = zone.Bounds.W / config.UIScaleFactor
 				zone.Bounds.Z = zone.Bounds.Z / config.UIScaleFactor
 
-				zone.Target.Bounds.X = zone.Target.Bounds.X / config.UIScaleFactor
-				zone.Target.Bounds.Y = zone.Target.Bounds.X / config.UIScaleFactor
-				zone.Target.Bounds.W = zone.Target.Bounds.W / config.UIScaleFactor
-				zone.Target.Bounds.Z = zone.Target.Bounds.Z / config.UIScaleFactor
-
-				group.Transitions = append(group.Transitions, zone)
+				group.Transitions = append(group.Transitions, DisplayTransition{
+					Target: ids[zone.Target.UUID],
+					Bounds: zone.Bounds,
+				})
 			}
 
 			groups[i] = group
 		}
 
 		ctx.HTML(http.StatusOK, "index", gin.H{
-			"groups": groups,
+			"groups":    groups,
+			"broadcast": broadcast,
 		})
 	}
 }
+
+// hostnames of the given peers
+func (ui *UI) hostnames(ids []uuid.UUID) []string {
+	var (
+		names []string
+		peers = ui.screenManager.Snapshot()
+	)
+
+	for _, id := range ids {
+		for _, peer := range peers {
+			if peer.UUID == id {
+				names = append(names, peer.Hostname)
+			}
+		}
+	}
+
+	return names
+}
@@ -2,17 +2,20 @@ package ui
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/indeedhat/harmony/internal/net/server/socket"
 	"github.com/indeedhat/harmony/internal/screens"
 )
 
 type UI struct {
 	screenManager *screens.ScreenManager
+	socket        *socket.Socket
 }
 
 // New UI controller
-func New(router *gin.Engine, screenManager *screens.ScreenManager) *UI {
+func New(router *gin.Engine, screenManager *screens.ScreenManager, socket *socket.Socket) *UI {
 	ui := &UI{
 		screenManager: screenManager,
+		socket:        socket,
 	}
 
 	ui.routes(router)
@@ -0,0 +1,349 @@
+package udp
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// retransmission tuning for reliable packets
+const (
+	// windowSize is how far ahead of the oldest unacked packet the reliable sequence can get
+	windowSize         = 64
+	retransmitInterval = 30 * time.Millisecond
+	// maxRetransmits before the channel is given up on
+	maxRetransmits = 10
+)
+
+type pendingPacket struct {
+	rseq    uint32
+	payload []byte
+	sent    time.Time
+	tries   int
+}
+
+// Channel is one end of a udp data channel
+//
+// motion is sent unreliably, anything else is retransmitted until it is acked and is delivered in
+// order, once retransmission gives up the channel is marked as failed and the unacked data should be
+// sent over the websocket instead
+type Channel struct {
+	session uint32
+	aead    cipher.AEAD
+	// direction of the packets this end sends
+	dir byte
+	con *net.UDPConn
+	// address to send packets to, on the server this is learned from the peers hello
+	remote *net.UDPAddr
+	// if the socket belongs to this channel rather than being shared
+	owned       bool
+	lossPercent int
+	// receive is called with the payload of every packet, in order for reliable ones
+	receive func([]byte)
+	// fail is called once retransmission gives up
+	fail func()
+
+	seq    uint64
+	replay replayWindow
+	// reliable send state
+	nextRSeq uint32
+	unacked  []*pendingPacket
+	// reliable recieve state
+	expectRSeq uint32
+	held       map[uint32][]byte
+	lastMotion uint64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	failed    bool
+	closed    bool
+	done      chan struct{}
+	mux       sync.Mutex
+}
+
+func newChannel(
+	con *net.UDPConn,
+	session uint32,
+	key []byte,
+	dir byte,
+	lossPercent int,
+	receive func([]byte),
+	fail func(),
+) (*Channel, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &Channel{
+		session:     session,
+		aead:        aead,
+		dir:         dir,
+		con:         con,
+		lossPercent: lossPercent,
+		receive:     receive,
+		fail:        fail,
+		expectRSeq:  1,
+		held:        make(map[uint32][]byte),
+		ready:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go ch.retransmit()
+
+	return ch, nil
+}
+
+// Send data over the channel
+// false is returned if the channel cant take the data, it should be sent over the websocket instead
+func (ch *Channel) Send(data []byte, reliable bool) bool {
+	ch.mux.Lock()
+	defer ch.mux.Unlock()
+
+	if ch.failed || ch.closed || ch.remote == nil {
+		return false
+	}
+
+	if !reliable {
+		if headerSize+len(data)+ch.aead.Overhead() > maxPacketSize {
+			return false
+		}
+
+		ch.write(kindMotion, data)
+		return true
+	}
+
+	// reliable data that cant go over the channel would overtake the data still waiting on an ack
+	// so the whole channel is given up on
+	// the other end only holds packets within the window of the oldest one it is missing so the window
+	// is measured from the oldest unacked packet rather than by how many are unacked
+	if (len(ch.unacked) > 0 && ch.nextRSeq+1-ch.unacked[0].rseq >= windowSize) ||
+		headerSize+rseqSize+len(data)+ch.aead.Overhead() > maxPacketSize {
+		ch.failed = true
+		return false
+	}
+
+	ch.nextRSeq++
+	payload := make([]byte, rseqSize, rseqSize+len(data))
+	binary.BigEndian.PutUint32(payload, ch.nextRSeq)
+
+	packet := &pendingPacket{rseq: ch.nextRSeq, payload: append(payload, data...)}
+	ch.unacked = append(ch.unacked, packet)
+	ch.transmit(packet)
+
+	return true
+}
+
+// Session the channel belongs to
+func (ch *Channel) Session() uint32 {
+	return ch.session
+}
+
+// Failed reports if the channel has been given up on
+func (ch *Channel) Failed() bool {
+	ch.mux.Lock()
+	defer ch.mux.Unlock()
+
+	return ch.failed
+}
+
+// Ready is closed once both ends of the channel have heard from each other
+func (ch *Channel) Ready() <-chan struct{} {
+	return ch.ready
+}
+
+// Pending gives the reliable data that was never acked, in the order it was sent
+func (ch *Channel) Pending() [][]byte {
+	ch.mux.Lock()
+	defer ch.mux.Unlock()
+
+	pending := make([][]byte, 0, len(ch.unacked))
+	for _, packet := range ch.unacked {
+		pending = append(pending, packet.payload[rseqSize:])
+	}
+
+	ch.unacked = nil
+	return pending
+}
+
+// Close the channel
+func (ch *Channel) Close() {
+	ch.mux.Lock()
+	defer ch.mux.Unlock()
+
+	if ch.closed {
+		return
+	}
+
+	ch.closed = true
+	close(ch.done)
+
+	if ch.owned {
+		ch.con.Close()
+	}
+}
+
+// handle a packet recieved from the other end
+func (ch *Channel) handle(data []byte, from *net.UDPAddr) {
+	otherDir := dirServer
+	if ch.dir == dirServer {
+		otherDir = dirClient
+	}
+
+	h, payload, err := open(ch.aead, otherDir, data)
+	if err != nil || h.session != ch.session {
+		return
+	}
+
+	var deliver [][]byte
+
+	ch.mux.Lock()
+	if ch.closed || !ch.replay.check(h.seq) {
+		ch.mux.Unlock()
+		return
+	}
+
+	// the server follows the peer if its address changes
+	if ch.dir == dirServer {
+		ch.remote = from
+	}
+
+	switch h.kind {
+	case kindHello:
+		ch.write(kindHelloAck, nil)
+		ch.markReady()
+
+	case kindHelloAck:
+		ch.markReady()
+
+	case kindMotion:
+		if h.seq > ch.lastMotion {
+			ch.lastMotion = h.seq
+			deliver = append(deliver, payload)
+		}
+
+	case kindReliable:
+		if len(payload) < rseqSize {
+			break
+		}
+
+		// only packets that are held or have already been delivered are acked, anything outside the
+		// window is dropped and left for the other end to retransmit
+		rseq := binary.BigEndian.Uint32(payload)
+		if rseq >= ch.expectRSeq+windowSize {
+			break
+		}
+
+		if rseq >= ch.expectRSeq {
+			ch.held[rseq] = payload[rseqSize:]
+		}
+
+		ch.write(kindAck, payload[:rseqSize])
+
+		for {
+			next, ok := ch.held[ch.expectRSeq]
+			if !ok {
+				break
+			}
+
+			deliver = append(deliver, next)
+			delete(ch.held, ch.expectRSeq)
+			ch.expectRSeq++
+		}
+
+	case kindAck:
+		if len(payload) < rseqSize {
+			break
+		}
+
+		rseq := binary.BigEndian.Uint32(payload)
+		for i, packet := range ch.unacked {
+			if packet.rseq == rseq {
+				ch.unacked = append(ch.unacked[:i], ch.unacked[i+1:]...)
+				break
+			}
+		}
+	}
+	ch.mux.Unlock()
+
+	for _, data := range deliver {
+		ch.receive(data)
+	}
+}
+
+// retransmit reliable packets that have not been acked in time
+func (ch *Channel) retransmit() {
+	ticker := time.NewTicker(retransmitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ch.done:
+			return
+
+		case <-ticker.C:
+			if ch.resendUnacked() {
+				ch.fail()
+				return
+			}
+		}
+	}
+}
+
+// resendUnacked packets, returns true if the channel has just been given up on
+func (ch *Channel) resendUnacked() bool {
+	ch.mux.Lock()
+	defer ch.mux.Unlock()
+
+	if ch.failed {
+		return false
+	}
+
+	for _, packet := range ch.unacked {
+		if time.Since(packet.sent) < retransmitInterval {
+			continue
+		}
+
+		if packet.tries > maxRetransmits {
+			ch.failed = true
+			return true
+		}
+
+		ch.transmit(packet)
+	}
+
+	return false
+}
+
+func (ch *Channel) transmit(packet *pendingPacket) {
+	packet.tries++
+	packet.sent = time.Now()
+	ch.write(kindReliable, packet.payload)
+}
+
+// write a packet to the other end
+// the lock must be held
+func (ch *Channel) write(k kind, payload []byte) {
+	if ch.remote == nil {
+		return
+	}
+
+	ch.seq++
+	packet := seal(ch.aead, ch.dir, header{kind: k, session: ch.session, seq: ch.seq}, payload)
+
+	// induced loss for testing
+	if ch.lossPercent > 0 && rand.Intn(100) < ch.lossPercent {
+		return
+	}
+
+	ch.con.WriteToUDP(packet, ch.remote)
+}
+
+func (ch *Channel) markReady() {
+	ch.readyOnce.Do(func() {
+		close(ch.ready)
+	})
+}
@@ -0,0 +1,146 @@
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// loopback opens both ends of a channel on the loopback interface
+// packets are only dropped once the channel is up so that the hello is not lost
+func loopback(t *testing.T, lossPercent int, receive func([]byte)) (*Channel, *Channel) {
+	t.Helper()
+
+	fail := func() { t.Error("channel given up on") }
+
+	l, err := Listen(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	server, offer, err := l.Offer(receive, fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer.Port = uint16(l.con.LocalAddr().(*net.UDPAddr).Port)
+
+	client, err := Dial("127.0.0.1", offer, 0, func([]byte) {}, fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	t.Cleanup(func() { l.Remove(server) })
+
+	for _, ch := range []*Channel{server, client} {
+		ch.mux.Lock()
+		ch.lossPercent = lossPercent
+		ch.mux.Unlock()
+	}
+
+	return server, client
+}
+
+func TestReliableDeliveryWithLoss(t *testing.T) {
+	const (
+		batches   = 4
+		batchSize = windowSize / 2
+	)
+
+	received := make(chan uint32, batches*batchSize)
+	_, client := loopback(t, 20, func(data []byte) {
+		received <- binary.BigEndian.Uint32(data)
+	})
+
+	var next uint32
+	for b := 0; b < batches; b++ {
+		for i := 0; i < batchSize; i++ {
+			next++
+			data := make([]byte, 4)
+			binary.BigEndian.PutUint32(data, next)
+
+			if !client.Send(data, true) {
+				t.Fatalf("send %d refused", next)
+			}
+		}
+
+		for i := next - batchSize + 1; i <= next; i++ {
+			select {
+			case got := <-received:
+				if got != i {
+					t.Fatalf("expected %d, got %d", i, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %d", i)
+			}
+		}
+
+		// acks can still be getting retransmitted once everything has been delivered
+		waitForAcks(t, client)
+	}
+}
+
+func waitForAcks(t *testing.T, ch *Channel) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ch.mux.Lock()
+		unacked := len(ch.unacked)
+		ch.mux.Unlock()
+
+		if unacked == 0 {
+			return
+		}
+
+		time.Sleep(retransmitInterval)
+	}
+
+	t.Fatal("timed out waiting for acks")
+}
+
+func TestSendWindowFollowsOldestUnacked(t *testing.T) {
+	_, client := loopback(t, 0, func([]byte) {})
+
+	client.mux.Lock()
+	// the oldest packet is stuck while everything after it has been acked
+	client.nextRSeq = windowSize
+	client.unacked = []*pendingPacket{{rseq: 1, sent: time.Now()}}
+	client.mux.Unlock()
+
+	if client.Send([]byte{1}, true) {
+		t.Fatal("send beyond the window of the oldest unacked packet was accepted")
+	}
+}
+
+func TestOutOfWindowPacketsAreNotAcked(t *testing.T) {
+	server, client := loopback(t, 0, func([]byte) {})
+
+	// the client end is pushed far enough ahead that the server cant hold the packet
+	client.mux.Lock()
+	client.nextRSeq = windowSize + 1
+	client.mux.Unlock()
+
+	if !client.Send([]byte{1}, true) {
+		t.Fatal("send refused")
+	}
+
+	time.Sleep(5 * retransmitInterval)
+
+	client.mux.Lock()
+	unacked := len(client.unacked)
+	client.mux.Unlock()
+
+	server.mux.Lock()
+	held := len(server.held)
+	server.mux.Unlock()
+
+	if unacked != 1 {
+		t.Fatalf("expected the packet to still be unacked, %d unacked", unacked)
+	}
+
+	if held != 0 {
+		t.Fatalf("expected nothing to be held, %d held", held)
+	}
+}
@@ -0,0 +1,80 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// how many times the hello is sent before giving up on the server
+const (
+	helloAttempts = 5
+	helloInterval = 200 * time.Millisecond
+)
+
+// Dial the listening end of a data channel from the offer it sent
+// this blocks until the listener has answered the hello, if it never does the websocket should be used
+func Dial(
+	host string,
+	offer *events.UdpOffer,
+	lossPercent int,
+	receive func([]byte),
+	fail func(),
+) (*Channel, error) {
+	remote, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(int(offer.Port))))
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := newChannel(con, offer.Session, offer.Key, dirClient, lossPercent, receive, fail)
+	if err != nil {
+		con.Close()
+		return nil, err
+	}
+
+	ch.remote = remote
+	ch.owned = true
+
+	go readChannel(con, ch)
+
+	for i := 0; i < helloAttempts; i++ {
+		ch.mux.Lock()
+		ch.write(kindHello, nil)
+		ch.mux.Unlock()
+
+		select {
+		case <-ch.Ready():
+			return ch, nil
+		case <-time.After(helloInterval):
+		}
+	}
+
+	ch.Close()
+	return nil, errors.New("no response from server")
+}
+
+// readChannel reads the packets for a channel that owns its socket
+func readChannel(con *net.UDPConn, ch *Channel) {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, from, err := con.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			continue
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		ch.handle(packet, from)
+	}
+}
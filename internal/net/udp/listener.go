@@ -0,0 +1,178 @@
+package udp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+// Listener is the accepting end of the data channels, all of its channels share the one socket
+type Listener struct {
+	con         *net.UDPConn
+	port        int
+	lossPercent int
+	sessions    map[uint32]*Channel
+	mux         sync.Mutex
+}
+
+// Listen for data channels on the given port
+// lossPercent of outgoing packets are dropped, this is for testing how the channels cope with loss
+func Listen(port, lossPercent int) (*Listener, error) {
+	con, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		con:         con,
+		port:        port,
+		lossPercent: lossPercent,
+		sessions:    make(map[uint32]*Channel),
+	}
+
+	go l.read()
+
+	return l, nil
+}
+
+// Offer a new data channel
+// the returned offer is sent to the peer over the websocket so that it can open its end
+func (l *Listener) Offer(receive func([]byte), fail func()) (*Channel, *events.UdpOffer, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	session, err := l.newSession()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, err := l.accept(session, key, receive, fail)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ch, &events.UdpOffer{
+		Session: session,
+		Key:     key,
+		Port:    uint16(l.port),
+	}, nil
+}
+
+// Accept a data channel for a session that was set up by someone else
+func (l *Listener) Accept(session uint32, key []byte, receive func([]byte), fail func()) (*Channel, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, ok := l.sessions[session]; ok || session == 0 {
+		return nil, errors.New("session already in use")
+	}
+
+	return l.accept(session, key, receive, fail)
+}
+
+// accept a channel for the session
+// the lock must be held
+func (l *Listener) accept(session uint32, key []byte, receive func([]byte), fail func()) (*Channel, error) {
+	ch, err := newChannel(l.con, session, key, dirServer, l.lossPercent, receive, fail)
+	if err != nil {
+		return nil, err
+	}
+
+	l.sessions[session] = ch
+	return ch, nil
+}
+
+// Remove a data channel and close it
+func (l *Listener) Remove(ch *Channel) {
+	l.mux.Lock()
+	delete(l.sessions, ch.session)
+	l.mux.Unlock()
+
+	ch.Close()
+}
+
+// Close the listener
+func (l *Listener) Close() error {
+	return l.con.Close()
+}
+
+// newSession picks an unused session id
+// the lock must be held
+func (l *Listener) newSession() (uint32, error) {
+	for i := 0; i < 8; i++ {
+		session, err := NewSession()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, ok := l.sessions[session]; !ok {
+			return session, nil
+		}
+	}
+
+	return 0, errors.New("failed to pick a session id")
+}
+
+// NewSession id picked at random
+func NewSession() (uint32, error) {
+	buf := make([]byte, 4)
+
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return 0, err
+		}
+
+		if session := binary.BigEndian.Uint32(buf); session != 0 {
+			return session, nil
+		}
+	}
+}
+
+// NewKey for a session
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (l *Listener) read() {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, from, err := l.con.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			continue
+		}
+
+		h, ok := parseHeader(buf[:n])
+		if !ok {
+			continue
+		}
+
+		l.mux.Lock()
+		ch := l.sessions[h.session]
+		l.mux.Unlock()
+
+		if ch == nil {
+			continue
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		ch.handle(packet, from)
+	}
+}
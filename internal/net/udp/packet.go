@@ -0,0 +1,147 @@
+package udp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+)
+
+// kind of packet sent over the data channel
+type kind uint8
+
+const (
+	// kindHello is sent by the peer to open the channel, it tells the server where to send packets
+	kindHello kind = iota
+	kindHelloAck
+	// kindMotion packets are sent once, lost or late ones are dropped
+	kindMotion
+	// kindReliable packets are retransmitted until acked and delivered in order
+	kindReliable
+	kindAck
+)
+
+// direction of a packet, it is part of the nonce so that the two ends never reuse one with the shared key
+const (
+	dirClient byte = 1
+	dirServer byte = 2
+)
+
+// KeySize of the session key
+const KeySize = 32
+
+const (
+	// kind, session and sequence number
+	headerSize = 1 + 4 + 8
+	// largest packet that will be sent, anything bigger goes over the websocket
+	maxPacketSize = 1400
+	// size of the sequence number prefixed to reliable payloads
+	rseqSize = 4
+)
+
+var errBadPacket = errors.New("bad packet")
+
+// header is sent in the clear but is authenticated along with the payload
+type header struct {
+	kind    kind
+	session uint32
+	// seq is unique for every packet sent in a direction
+	seq uint64
+}
+
+func (h header) bytes() []byte {
+	buf := make([]byte, headerSize)
+	buf[0] = byte(h.kind)
+	binary.BigEndian.PutUint32(buf[1:5], h.session)
+	binary.BigEndian.PutUint64(buf[5:], h.seq)
+
+	return buf
+}
+
+func parseHeader(data []byte) (header, bool) {
+	if len(data) < headerSize {
+		return header{}, false
+	}
+
+	return header{
+		kind:    kind(data[0]),
+		session: binary.BigEndian.Uint32(data[1:5]),
+		seq:     binary.BigEndian.Uint64(data[5:headerSize]),
+	}, true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func nonce(dir byte, seq uint64) []byte {
+	buf := make([]byte, 12)
+	buf[0] = dir
+	binary.BigEndian.PutUint64(buf[4:], seq)
+
+	return buf
+}
+
+// seal the payload into a packet
+func seal(aead cipher.AEAD, dir byte, h header, payload []byte) []byte {
+	head := h.bytes()
+	return aead.Seal(head, nonce(dir, h.seq), payload, head)
+}
+
+// open a packet sent in the given direction
+func open(aead cipher.AEAD, dir byte, data []byte) (header, []byte, error) {
+	h, ok := parseHeader(data)
+	if !ok {
+		return h, nil, errBadPacket
+	}
+
+	payload, err := aead.Open(nil, nonce(dir, h.seq), data[headerSize:], data[:headerSize])
+	if err != nil {
+		return h, nil, errBadPacket
+	}
+
+	return h, payload, nil
+}
+
+// replayWindow tracks the recently seen sequence numbers so that a captured packet cant be replayed
+type replayWindow struct {
+	top  uint64
+	seen uint64
+}
+
+// check the sequence number, returns false if it has been seen before or is too old to tell
+func (w *replayWindow) check(seq uint64) bool {
+	switch {
+	case seq == 0:
+		return false
+
+	case seq > w.top:
+		shift := seq - w.top
+		if shift >= 64 {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+
+		w.seen |= 1
+		w.top = seq
+		return true
+
+	case w.top-seq >= 64:
+		return false
+
+	default:
+		bit := uint64(1) << (w.top - seq)
+		if w.seen&bit != 0 {
+			return false
+		}
+
+		w.seen |= bit
+		return true
+	}
+}
@@ -0,0 +1,164 @@
+package recording
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// header written at the start of every recording so that old/foreign files can be rejected
+const (
+	magic   = "HRMREC"
+	version = 1
+)
+
+type RecordType uint8
+
+const (
+	// RecordInput holds a frame of input sent to the focused peer
+	RecordInput RecordType = iota
+	// RecordFocus marks focus moving to the target peer
+	RecordFocus
+	// RecordRelease marks focus returning to the local peer
+	RecordRelease
+)
+
+// Record is a single entry in a recording
+type Record struct {
+	// Time the record was made in unix nanoseconds
+	Time int64      `msgpack:"t"`
+	Type RecordType `msgpack:"k"`
+	// Target peer that had focus at the time of the record
+	Target uuid.UUID          `msgpack:"p"`
+	Frame  *events.InputFrame `msgpack:"f,omitempty"`
+}
+
+// Writer appends records to a recording
+type Writer struct {
+	file io.WriteCloser
+	buf  *bufio.Writer
+	enc  *msgpack.Encoder
+	mux  sync.Mutex
+}
+
+// Create a new recording file, overwriting any existing file at the path
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	return NewWriter(file)
+}
+
+// NewWriter starts a new recording on the given writer
+func NewWriter(file io.WriteCloser) (*Writer, error) {
+	buf := bufio.NewWriter(file)
+	w := &Writer{
+		file: file,
+		buf:  buf,
+		enc:  msgpack.NewEncoder(buf),
+	}
+
+	if err := w.enc.EncodeString(magic); err != nil {
+		return nil, err
+	}
+
+	if err := w.enc.EncodeUint8(version); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write a record to the recording
+// each record is flushed as it is written so nothing is lost if the process is killed
+func (w *Writer) Write(rec *Record) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if err := w.enc.Encode(rec); err != nil {
+		return err
+	}
+
+	return w.buf.Flush()
+}
+
+// Close the recording flushing any buffered records
+func (w *Writer) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+// Reader reads records from a recording
+type Reader struct {
+	file io.Closer
+	dec  *msgpack.Decoder
+}
+
+// Open an existing recording
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	r, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NewReader validates the recording header and prepares the records for reading
+func NewReader(file io.ReadCloser) (*Reader, error) {
+	dec := msgpack.NewDecoder(bufio.NewReader(file))
+
+	header, err := dec.DecodeString()
+	if err != nil || header != magic {
+		return nil, errors.New("not a harmony recording")
+	}
+
+	v, err := dec.DecodeUint8()
+	if err != nil || v != version {
+		return nil, fmt.Errorf("unsupported recording version: %d", v)
+	}
+
+	return &Reader{
+		file: file,
+		dec:  dec,
+	}, nil
+}
+
+// Next record in the recording
+// io.EOF will be returned once all records have been read
+func (r *Reader) Next() (*Record, error) {
+	var rec Record
+
+	if err := r.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+// Close the recording
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
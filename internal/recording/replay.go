@@ -0,0 +1,69 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+	. "github.com/indeedhat/harmony/internal/logger"
+)
+
+// Sink is anything that input events can be replayed into, in practice this will be a virtual device
+type Sink interface {
+	Write(*events.InputEvent) error
+}
+
+// ReplayOptions control how a recording is played back
+type ReplayOptions struct {
+	// Speed multiplier for the gaps between records, 0 will replay with no gaps at all
+	Speed float64
+	// Target will limit the replay to input sent to the given peer, if left empty all input is replayed
+	Target uuid.UUID
+}
+
+// Replay the input records from a recording into the sink
+func Replay(ctx context.Context, r *Reader, sink Sink, opts ReplayOptions) error {
+	var last int64
+
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if last != 0 && opts.Speed > 0 {
+			gap := time.Duration(float64(rec.Time-last) / opts.Speed)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(gap):
+			}
+		}
+		last = rec.Time
+
+		switch rec.Type {
+		case RecordFocus:
+			Logf("replay", "focus moved to %s", rec.Target)
+			continue
+		case RecordRelease:
+			Log("replay", "focus released")
+			continue
+		}
+
+		if rec.Frame == nil || (opts.Target != uuid.Nil && opts.Target != rec.Target) {
+			continue
+		}
+
+		for i := range rec.Frame.Events {
+			if err := sink.Write(&rec.Frame.Events[i]); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/indeedhat/harmony/internal/events"
+)
+
+type fakeSink struct {
+	events []events.InputEvent
+}
+
+func (s *fakeSink) Write(ev *events.InputEvent) error {
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestReplayRecording(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		peerA = uuid.New()
+		peerB = uuid.New()
+	)
+
+	w, err := NewWriter(nopWriteCloser{&buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*Record{
+		{Time: 1, Type: RecordFocus, Target: peerA},
+		{Time: 2, Type: RecordInput, Target: peerA, Frame: &events.InputFrame{
+			Events: []events.InputEvent{{Code: 30, Value: 1}, {Code: 30, Value: 0}},
+		}},
+		{Time: 3, Type: RecordFocus, Target: peerB},
+		{Time: 4, Type: RecordInput, Target: peerB, Frame: &events.InputFrame{
+			Events: []events.InputEvent{{Code: 48, Value: 1}},
+		}},
+		{Time: 5, Type: RecordRelease},
+	}
+
+	// records must be readable before the writer is closed
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target uuid.UUID
+		codes  []uint16
+	}{
+		{"all peers", uuid.Nil, []uint16{30, 30, 48}},
+		{"single peer", peerB, []uint16{48}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(io.NopCloser(bytes.NewReader(buf.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sink fakeSink
+			if err := Replay(context.Background(), r, &sink, ReplayOptions{Target: tt.target}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sink.events) != len(tt.codes) {
+				t.Fatalf("expected %d events, got %d", len(tt.codes), len(sink.events))
+			}
+
+			for i, code := range tt.codes {
+				if sink.events[i].Code != code {
+					t.Errorf("event %d: expected code %d, got %d", i, code, sink.events[i].Code)
+				}
+			}
+		})
+	}
+}
+
+func TestNewReaderRejectsForeignFile(t *testing.T) {
+	if _, err := NewReader(io.NopCloser(bytes.NewReader([]byte("not a recording")))); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,102 @@
+package screens
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// default file the layout is stored in if none is configured
+const DefaultLayoutFile = "layout.json"
+
+// Layout remembers the order peers are arranged in, left to right
+// it is persisted on every change so that peers keep their place across restarts of the server
+type Layout struct {
+	path  string
+	order []uuid.UUID
+	mux   sync.Mutex
+}
+
+// LoadLayout from file
+// a missing file is treated as an empty layout
+func LoadLayout(path string) (*Layout, error) {
+	if path == "" {
+		path = DefaultLayoutFile
+	}
+
+	layout := &Layout{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return layout, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read layout: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &layout.order); err != nil {
+		return nil, fmt.Errorf("failed to parse layout: %w", err)
+	}
+
+	return layout, nil
+}
+
+// Place of the peer in the layout
+// peers that have not been seen before are placed to the right of all the others
+func (l *Layout) Place(id uuid.UUID) (int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if i := l.index(id); i != -1 {
+		return i, nil
+	}
+
+	l.order = append(l.order, id)
+
+	return len(l.order) - 1, l.save()
+}
+
+// Forget a peer so that it is placed at the end if it ever comes back
+func (l *Layout) Forget(id uuid.UUID) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	i := l.index(id)
+	if i == -1 {
+		return nil
+	}
+
+	l.order = append(l.order[:i], l.order[i+1:]...)
+
+	return l.save()
+}
+
+func (l *Layout) index(id uuid.UUID) int {
+	for i, known := range l.order {
+		if known == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// save the layout to file
+// it is written to a temp file first so a failed write cannot lose the existing layout
+func (l *Layout) save() error {
+	data, err := json.MarshalIndent(l.order, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write layout: %w", err)
+	}
+
+	return os.Rename(tmp, l.path)
+}
@@ -5,10 +5,11 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/indeedhat/harmony/internal/common"
+	. "github.com/indeedhat/harmony/internal/logger"
 )
 
 // TODO: this is a  temporary solution to get the system working
-// it will just put new clients to the far right of existing ones
+// it will just put new clients to the far right of existing ones, or back in their remembered place
 // once i build the ui it will need to be updated to properly arrange peers
 
 type Peer struct {
@@ -26,13 +27,16 @@ func (peer *Peer) AbsolutePosition(bounds DisplayBounds) common.Vector2 {
 type ScreenManager struct {
 	Peers []Peer
 
-	mux *sync.Mutex
+	layout *Layout
+	mux    *sync.Mutex
 }
 
 // NewScreenManager sets up a new manager for screen arrangement and transition
-func NewScreenManager() *ScreenManager {
+// peers are arranged in the order they are remembered in the layout
+func NewScreenManager(layout *Layout) *ScreenManager {
 	return &ScreenManager{
-		mux: &sync.Mutex{},
+		layout: layout,
+		mux:    &sync.Mutex{},
 	}
 }
 
@@ -43,7 +47,7 @@ func (mgr *ScreenManager) AddPeer(id uuid.UUID, displays []DisplayBounds, hostna
 	defer mgr.mux.Unlock()
 
 	if !mgr.PeerExists(id) {
-		mgr.Peers = append(mgr.Peers, Peer{
+		mgr.insertPeer(Peer{
 			UUID:     id,
 			Hostname: hostname,
 			Displays: displays,
@@ -53,6 +57,34 @@ func (mgr *ScreenManager) AddPeer(id uuid.UUID, displays []DisplayBounds, hostna
 	return mgr.CalculateTransitionZones()
 }
 
+// ForgetPeer so that it takes a new place in the layout if it ever joins again
+func (mgr *ScreenManager) ForgetPeer(id uuid.UUID) {
+	if err := mgr.layout.Forget(id); err != nil {
+		Logf("screens", "failed to save layout: %s", err)
+	}
+}
+
+// insertPeer at its place in the layout
+// the lock must be held
+func (mgr *ScreenManager) insertPeer(peer Peer) {
+	place, err := mgr.layout.Place(peer.UUID)
+	if err != nil {
+		Logf("screens", "failed to save layout: %s", err)
+	}
+
+	i := len(mgr.Peers)
+	for j, existing := range mgr.Peers {
+		if p, _ := mgr.layout.Place(existing.UUID); p > place {
+			i = j
+			break
+		}
+	}
+
+	mgr.Peers = append(mgr.Peers, Peer{})
+	copy(mgr.Peers[i+1:], mgr.Peers[i:])
+	mgr.Peers[i] = peer
+}
+
 // RemovePeer from the screen manager
 // this will regenerate all the transition zones between all peers
 func (mgr *ScreenManager) RemovePeer(uuid uuid.UUID) map[uuid.UUID][]TransitionZone {
@@ -82,6 +114,68 @@ func (mgr *ScreenManager) PeerExists(uuid uuid.UUID) bool {
 	return false
 }
 
+// FindPeerByHostname returns a copy of the peer with the given hostname or nil if it is not being tracked
+func (mgr *ScreenManager) FindPeerByHostname(hostname string) *Peer {
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
+	for _, peer := range mgr.Peers {
+		if peer.Hostname == hostname {
+			return &peer
+		}
+	}
+
+	return nil
+}
+
+// Snapshot of the peers in layout order
+// it is safe to use while peers join and leave
+func (mgr *ScreenManager) Snapshot() []Peer {
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
+	return append([]Peer(nil), mgr.Peers...)
+}
+
+// TransitionZones between the peers currently being tracked
+func (mgr *ScreenManager) TransitionZones() map[uuid.UUID][]TransitionZone {
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
+	return mgr.CalculateTransitionZones()
+}
+
+// PeerArea gives the bounding rectangle of all the displays on a peer in the peers own coordinate space
+func (mgr *ScreenManager) PeerArea(id uuid.UUID) (common.Vector4, bool) {
+	mgr.mux.Lock()
+	defer mgr.mux.Unlock()
+
+	for _, peer := range mgr.Peers {
+		if peer.UUID != id || len(peer.Displays) == 0 {
+			continue
+		}
+
+		first := peer.Displays[0]
+		area := common.Vector4{
+			X: first.Position.X,
+			Y: first.Position.Y,
+			W: first.Position.X + first.Width,
+			Z: first.Position.Y + first.Height,
+		}
+
+		for _, display := range peer.Displays[1:] {
+			area.X = common.Min(area.X, display.Position.X)
+			area.Y = common.Min(area.Y, display.Position.Y)
+			area.W = common.Max(area.W, display.Position.X+display.Width)
+			area.Z = common.Max(area.Z, display.Position.Y+display.Height)
+		}
+
+		return area, true
+	}
+
+	return common.Vector4{}, false
+}
+
 // CalculateTransitionZones between peers
 func (mgr *ScreenManager) CalculateTransitionZones() map[uuid.UUID][]TransitionZone {
 	zones := make(map[uuid.UUID][]TransitionZone)
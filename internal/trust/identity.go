@@ -0,0 +1,140 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// default file the peers identity is stored in if none is configured
+const DefaultIdentityFile = "identity"
+
+// identityContext is prefixed to everything an identity signs so that the signature cant be reused
+// for anything else
+const identityContext = "harmony-identity"
+
+// Identity of a peer
+// the uuid names the peer and the key proves it is the peer that was approved, the uuid alone is not
+// secret so the server pins the public key when it approves a peer
+type Identity struct {
+	UUID uuid.UUID
+	Key  ed25519.PrivateKey
+}
+
+// LoadIdentity loads the peers uuid and key from file, generating and saving new ones on first run
+// the key is kept next to the uuid with a .key suffix
+func LoadIdentity(path string) (*Identity, error) {
+	if path == "" {
+		path = DefaultIdentityFile
+	}
+
+	id, err := loadUUID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := loadKey(path + ".key")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{UUID: id, Key: key}, nil
+}
+
+// PublicKey the server pins for the peer
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.Key.Public().(ed25519.PublicKey)
+}
+
+// Sign the servers challenge to prove the peer holds the key for its uuid
+func (id *Identity) Sign(challenge []byte) []byte {
+	return ed25519.Sign(id.Key, identityMessage(id.UUID, challenge))
+}
+
+// VerifyIdentity checks that the signature over the challenge was made by the key for the uuid
+func VerifyIdentity(id uuid.UUID, publicKey, challenge, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(publicKey, identityMessage(id, challenge), signature)
+}
+
+func identityMessage(id uuid.UUID, challenge []byte) []byte {
+	msg := append([]byte(identityContext), id[:]...)
+	return append(msg, challenge...)
+}
+
+func loadUUID(path string) (uuid.UUID, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		id, err := uuid.Parse(strings.TrimSpace(string(data)))
+		if err != nil {
+			return id, fmt.Errorf("bad identity file: %w", err)
+		}
+
+		return id, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return uuid.Nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	id := uuid.New()
+	if err := ioutil.WriteFile(path, []byte(id.String()+"\n"), 0644); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to save identity: %w", err)
+	}
+
+	return id, nil
+}
+
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("bad identity key file")
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("bad identity key file: %w", err)
+		}
+
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("identity key is not ed25519")
+		}
+
+		return edKey, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read identity key: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save identity key: %w", err)
+	}
+
+	return key, nil
+}
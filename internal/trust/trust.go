@@ -0,0 +1,148 @@
+package trust
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// default file the trusted peers are stored in if none is configured
+const DefaultFile = "trusted_peers.json"
+
+var ErrNotFound = errors.New("peer not trusted")
+
+// Peer that has been approved to join the cluster
+type Peer struct {
+	UUID     uuid.UUID `json:"uuid"`
+	Hostname string    `json:"hostname"`
+	Approved time.Time `json:"approved"`
+	// PublicKey the peer proved it holds when it was approved
+	PublicKey []byte `json:"public_key"`
+}
+
+// Store holds the peers that have been approved by an operator and persists them to file on every change
+type Store struct {
+	path  string
+	peers []Peer
+	mux   sync.Mutex
+}
+
+// Load the trust store from file
+// a missing file is treated as an empty store
+func Load(path string) (*Store, error) {
+	if path == "" {
+		path = DefaultFile
+	}
+
+	store := &Store{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read trusted peers: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.peers); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted peers: %w", err)
+	}
+
+	return store, nil
+}
+
+// All of the trusted peers
+func (s *Store) All() []Peer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]Peer(nil), s.peers...)
+}
+
+// Lookup a trusted peer
+func (s *Store) Lookup(id uuid.UUID) (Peer, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := s.index(id)
+	if i == -1 {
+		return Peer{}, false
+	}
+
+	return s.peers[i], true
+}
+
+// IsTrusted reports if the peer has been approved with the given key
+// peers approved before keys were pinned are not trusted until they are approved again
+func (s *Store) IsTrusted(id uuid.UUID, publicKey []byte) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := s.index(id)
+	return i != -1 && len(s.peers[i].PublicKey) != 0 && bytes.Equal(s.peers[i].PublicKey, publicKey)
+}
+
+// Approve a peer pinning its key, approving an already trusted peer updates its hostname and key
+func (s *Store) Approve(id uuid.UUID, hostname string, publicKey []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if i := s.index(id); i != -1 {
+		s.peers[i].Hostname = hostname
+		s.peers[i].PublicKey = publicKey
+		return s.save()
+	}
+
+	s.peers = append(s.peers, Peer{
+		UUID:      id,
+		Hostname:  hostname,
+		Approved:  time.Now(),
+		PublicKey: publicKey,
+	})
+
+	return s.save()
+}
+
+// Revoke a peers trust
+func (s *Store) Revoke(id uuid.UUID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := s.index(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	s.peers = append(s.peers[:i], s.peers[i+1:]...)
+	return s.save()
+}
+
+func (s *Store) index(id uuid.UUID) int {
+	for i, peer := range s.peers {
+		if peer.UUID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.peers, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write trusted peers: %w", err)
+	}
+
+	return os.Rename(tmp, s.path)
+}
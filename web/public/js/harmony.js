@@ -86,20 +86,23 @@ const Harmony = groups => {
 
 const format = data => {
     return data.map(group => ({
-        id: group.UUID,
+        id: group.ID,
         time: +new Date(), // thest to force update
         name: group.Hostname,
         pos: new Vector(),
         width: group.Width,
         height: group.Height,
+        keyboard: group.Keyboard || [],
+        pointer: group.Pointer || [],
+        broadcast: group.Broadcast,
         screens: (group.Displays || []).map(screen => ({
-            groupId: group.UUID,
+            groupId: group.ID,
             pos: new Vector(screen.Position.X, screen.Position.Y),
             width: screen.Width,
             height: screen.Height
         })),
         transitions: (group.Transitions || []).map(transition => ({
-            id: transition.Target.UUID,
+            id: transition.Target,
             pos: new Vector2(transition.Bounds.X, transition.Bounds.Y)
         }))
     }))
@@ -0,0 +1,60 @@
+const secretKey = "harmony.cluster_secret";
+
+// the api needs the cluster secret, ask for it once and keep it for next time
+const secret = () => {
+    let value = localStorage.getItem(secretKey);
+    if (!value) {
+        value = prompt("cluster secret");
+        if (value) {
+            localStorage.setItem(secretKey, value);
+        }
+    }
+
+    return value;
+};
+
+// request an api endpoint, the parsed response body is returned or null on failure
+const request = async (method, path) => {
+    let resp = await fetch(path, {
+        method,
+        headers: { Authorization: `Bearer ${secret()}` }
+    });
+
+    if (resp.status == 401) {
+        localStorage.removeItem(secretKey);
+    }
+
+    let body = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+        alert(body.error || `request failed: ${resp.status}`);
+        return null;
+    }
+
+    return body;
+};
+
+// peers are loaded through the api rather than rendered into the page so that their identities are
+// only given to someone who knows the cluster secret
+const Peers = () => {
+    Alpine.data("peers", () => ({
+        peers: [],
+
+        async init() {
+            this.peers = await request("GET", "/api/peers") || [];
+        },
+
+        async approve(uuid) {
+            if (await request("POST", `/api/peers/${uuid}/approve`)) {
+                window.location.reload();
+            }
+        },
+
+        async revoke(uuid) {
+            if (await request("DELETE", `/api/peers/${uuid}`)) {
+                window.location.reload();
+            }
+        }
+    }));
+};
+
+export default Peers;